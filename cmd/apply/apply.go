@@ -0,0 +1,78 @@
+package apply
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/marcboudreau/hvc"
+	"github.com/marcboudreau/hvc/cmd/internal/load"
+	"github.com/marcboudreau/hvc/spec"
+	"github.com/spf13/cobra"
+)
+
+// ApplyCmd is the cobra.Command that handles the apply option of this
+// application.
+var ApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Writes the target secrets recorded in a plan file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("missing plan filename")
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open plan file %s: %w", args[0], err)
+		}
+		defer file.Close()
+
+		var planFile hvc.PlanFile
+		if err := json.NewDecoder(file).Decode(&planFile); err != nil {
+			return fmt.Errorf("failed to decode plan file %s: %w", args[0], err)
+		}
+
+		keyFile := hvc.FingerprintKeyFile(args[0])
+		keyBytes, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read fingerprint key file %s: %w", keyFile, err)
+		}
+
+		key, err := hex.DecodeString(strings.TrimSpace(string(keyBytes)))
+		if err != nil {
+			return fmt.Errorf("failed to decode fingerprint key file %s: %w", keyFile, err)
+		}
+
+		// The copy job specification files are loaded the same way they were
+		// when planning.
+		copyJob, files, err := load.CopyJobOptions(planFile.SpecFiles, spec.LoadOptions{
+			Format:   planFile.SpecFormat,
+			Lenient:  planFile.SpecLenient,
+			Overlays: planFile.SpecOverlays,
+		})
+		if err != nil {
+			return err
+		}
+
+		if files.Digest != planFile.SpecDigest {
+			copyJob.Close()
+			return fmt.Errorf("copy job specification files %s changed since planning", strings.Join(planFile.SpecFiles, ", "))
+		}
+
+		copyJob.FingerprintKey = key
+		errorSlice := copyJob.Apply(planFile.Plans)
+
+		if err := copyJob.Close(); err != nil {
+			errorSlice = append(errorSlice, err)
+		}
+
+		if len(errorSlice) > 0 {
+			return fmt.Errorf("failed to apply plan: %s", errorSlice)
+		}
+
+		return nil
+	},
+}
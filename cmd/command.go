@@ -3,7 +3,13 @@ package cmd
 import (
 	"os"
 
+	"github.com/marcboudreau/hvc/cmd/apply"
 	"github.com/marcboudreau/hvc/cmd/copy"
+	"github.com/marcboudreau/hvc/cmd/diff"
+	"github.com/marcboudreau/hvc/cmd/internal/load"
+	"github.com/marcboudreau/hvc/cmd/plan"
+	"github.com/marcboudreau/hvc/cmd/render"
+	"github.com/marcboudreau/hvc/cmd/validate"
 	"github.com/spf13/cobra"
 )
 
@@ -14,7 +20,16 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&load.Format, "format", "", "format of the copy job specification (json, yaml, or hcl); detected from the file extension by default")
+	rootCmd.PersistentFlags().StringArrayVar(&load.Overlays, "overlay", nil, "overlay file applied to the copy job specification; can be repeated to apply several overlays in order")
+	rootCmd.PersistentFlags().BoolVar(&load.Lenient, "lenient", false, "ignore unknown fields in the copy job specification instead of rejecting them")
+
 	rootCmd.AddCommand(copy.CopyCmd)
+	rootCmd.AddCommand(plan.PlanCmd)
+	rootCmd.AddCommand(apply.ApplyCmd)
+	rootCmd.AddCommand(diff.DiffCmd)
+	rootCmd.AddCommand(validate.ValidateCmd)
+	rootCmd.AddCommand(render.RenderCmd)
 }
 
 // Execute executes the rootCmd's Run function.
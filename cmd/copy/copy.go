@@ -2,13 +2,15 @@ package copy
 
 import (
 	"fmt"
-	"os"
 
-	"github.com/marcboudreau/hvc"
-	"github.com/marcboudreau/hvc/spec"
+	"github.com/marcboudreau/hvc/cmd/internal/load"
+	"github.com/marcboudreau/hvc/cmd/plan"
 	"github.com/spf13/cobra"
 )
 
+// dryRun is set by the --dry-run flag of the CopyCmd.
+var dryRun bool
+
 // CopyCmd is the cobra.Command that handles the copy option of this
 // application.
 var CopyCmd = &cobra.Command{
@@ -16,25 +18,25 @@ var CopyCmd = &cobra.Command{
 	Short: "Copies secrets according to copy job specification",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
-			return fmt.Errorf("missing copy job specification filename")
+			return fmt.Errorf("missing copy job specification filenames")
 		}
 
-		file, err := os.Open(args[0])
+		copyJob, _, err := load.CopyJob(args)
 		if err != nil {
-			return fmt.Errorf("failed to open copy job specification file %s: %w", args[0], err)
+			return err
 		}
 
-		copyJobSpec, err := spec.LoadSpec(file)
-		if err != nil {
-			return fmt.Errorf("failed to load copy job specification file %s: %w", file.Name(), err)
+		if dryRun {
+			_, err := plan.Run(copyJob, cmd.OutOrStdout())
+			return err
 		}
 
-		copyJob, err := hvc.NewCopyJob(copyJobSpec)
-		if err != nil {
-			return fmt.Errorf("failed to resolve copy job specification: %w", err)
+		errorSlice := copyJob.Execute()
+
+		if err := copyJob.Close(); err != nil {
+			errorSlice = append(errorSlice, err)
 		}
 
-		errorSlice := copyJob.Execute()
 		if len(errorSlice) > 0 {
 			return fmt.Errorf("failed to copy secrets: %s", errorSlice)
 		}
@@ -42,3 +44,7 @@ var CopyCmd = &cobra.Command{
 		return nil
 	},
 }
+
+func init() {
+	CopyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "report which target secrets would be changed without writing them")
+}
@@ -0,0 +1,117 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/marcboudreau/hvc"
+	"github.com/marcboudreau/hvc/cmd/internal/load"
+	"github.com/spf13/cobra"
+)
+
+// DiffCmd is the cobra.Command that handles the diff option of this
+// application.
+var DiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Reports the keys of the target secrets that differ from their source values",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("missing copy job specification filenames")
+		}
+
+		copyJob, _, err := load.CopyJob(args)
+		if err != nil {
+			return err
+		}
+
+		diffs, errorSlice := copyJob.Diff()
+
+		if err := copyJob.Close(); err != nil {
+			errorSlice = append(errorSlice, err)
+		}
+
+		drifted := WriteDiffs(cmd.OutOrStdout(), diffs, showHashes)
+
+		if len(errorSlice) > 0 {
+			return fmt.Errorf("failed to diff copies: %s", errorSlice)
+		}
+
+		if exitCode && drifted > 0 {
+			return fmt.Errorf("%d target secrets differ from their source values", drifted)
+		}
+
+		return nil
+	},
+}
+
+var (
+	// showHashes is set by the --show-hashes flag of the DiffCmd.
+	showHashes bool
+
+	// exitCode is set by the --exit-code flag of the DiffCmd.
+	exitCode bool
+)
+
+func init() {
+	DiffCmd.Flags().BoolVar(&showHashes, "show-hashes", false, "show abbreviated SHA-256 hashes of the differing values instead of masking them")
+	DiffCmd.Flags().BoolVar(&exitCode, "exit-code", false, "exit with an error if any target secret differs from its source values")
+}
+
+// WriteDiffs writes a human readable description of the provided diffs to the
+// provided Writer and returns the number of target secrets that differ from
+// their source values. Secret values are never written; when showHashes is
+// true, abbreviated hashes of the values are written instead.
+func WriteDiffs(out io.Writer, diffs []*hvc.CopyDiff, showHashes bool) int {
+	drifted := 0
+	inSync := 0
+
+	for _, diff := range diffs {
+		if diff == nil {
+			continue
+		}
+
+		if diff.InSync() {
+			inSync++
+			fmt.Fprintf(out, "= %s\n", diff.Name)
+			continue
+		}
+
+		drifted++
+		if diff.Exists {
+			fmt.Fprintf(out, "~ %s\n", diff.Name)
+		} else {
+			fmt.Fprintf(out, "+ %s (missing)\n", diff.Name)
+		}
+
+		for _, key := range diff.Keys {
+			fmt.Fprintf(out, "    %s %s %s\n", changeSymbols[key.Type], key.Key, describeValues(key, showHashes))
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d differ, %d in sync\n", drifted, inSync)
+
+	return drifted
+}
+
+// describeValues describes the values of the provided KeyDiff, either masked
+// or as hashes.
+func describeValues(key hvc.KeyDiff, showHashes bool) string {
+	if !showHashes {
+		return "(value masked)"
+	}
+
+	switch key.Type {
+	case hvc.KeyAdded:
+		return fmt.Sprintf("(source %s)", key.SourceHash)
+	case hvc.KeyRemoved:
+		return fmt.Sprintf("(target %s)", key.TargetHash)
+	default:
+		return fmt.Sprintf("(target %s, source %s)", key.TargetHash, key.SourceHash)
+	}
+}
+
+var changeSymbols = map[hvc.KeyChangeType]string{
+	hvc.KeyAdded:   "+",
+	hvc.KeyChanged: "~",
+	hvc.KeyRemoved: "-",
+}
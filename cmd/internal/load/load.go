@@ -0,0 +1,70 @@
+// Package load provides the helpers shared by the commands of this application
+// to load copy job specification files.
+package load
+
+import (
+	"fmt"
+
+	"github.com/marcboudreau/hvc"
+	"github.com/marcboudreau/hvc/spec"
+)
+
+// Format is set by the --format flag of the root command. When empty, the
+// format of a copy job specification file is determined by its extension.
+var Format string
+
+// Lenient is set by the --lenient flag of the root command. When true, the
+// unknown fields of a copy job specification file are ignored instead of
+// rejected.
+var Lenient bool
+
+// Overlays is set by the --overlay flag of the root command. It holds the
+// paths of the overlay files applied to the copy job specification.
+var Overlays []string
+
+// Options returns the spec.LoadOptions structure corresponding to the flags of
+// the root command.
+func Options() (spec.LoadOptions, error) {
+	options := spec.LoadOptions{Lenient: Lenient, Overlays: Overlays}
+
+	if Format != "" {
+		format, err := spec.ParseFormat(Format)
+		if err != nil {
+			return spec.LoadOptions{}, err
+		}
+
+		options.Format = format
+	}
+
+	return options, nil
+}
+
+// CopyJob loads the copy job specification files, or directories of copy job
+// specification files, at the provided paths as specified by the flags of the
+// root command, and creates the corresponding hvc.CopyJob structure. The
+// spec.LoadedFiles structure describing every loaded file, including the
+// included ones and the overlays, is also returned.
+func CopyJob(paths []string) (*hvc.CopyJob, *spec.LoadedFiles, error) {
+	options, err := Options()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return CopyJobOptions(paths, options)
+}
+
+// CopyJobOptions loads the copy job specification files at the provided paths
+// as specified by the provided spec.LoadOptions structure, like CopyJob does.
+func CopyJobOptions(paths []string, options spec.LoadOptions) (*hvc.CopyJob, *spec.LoadedFiles, error) {
+	copyJobSpec, files, err := spec.LoadSpecFiles(paths, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	copyJob, err := hvc.NewCopyJob(copyJobSpec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve copy job specification: %w", err)
+	}
+
+	return copyJob, files, nil
+}
@@ -0,0 +1,160 @@
+package plan
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/marcboudreau/hvc"
+	"github.com/marcboudreau/hvc/cmd/internal/load"
+	"github.com/spf13/cobra"
+)
+
+// PlanCmd is the cobra.Command that handles the plan option of this
+// application.
+var PlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Reports which target secrets the copy job specification would change",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("missing copy job specification filenames")
+		}
+
+		options, err := load.Options()
+		if err != nil {
+			return err
+		}
+
+		copyJob, files, err := load.CopyJobOptions(args, options)
+		if err != nil {
+			return err
+		}
+
+		copyJob.FingerprintKey, err = hvc.NewFingerprintKey()
+		if err != nil {
+			copyJob.Close()
+			return err
+		}
+
+		plans, err := Run(copyJob, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+
+		if outFile == "" {
+			return nil
+		}
+
+		specFiles, err := absPaths(args)
+		if err != nil {
+			return err
+		}
+
+		specOverlays, err := absPaths(options.Overlays)
+		if err != nil {
+			return err
+		}
+
+		planBytes, err := json.MarshalIndent(&hvc.PlanFile{
+			SpecFiles:    specFiles,
+			SpecOverlays: specOverlays,
+			SpecDigest:   files.Digest,
+			SpecFormat:   options.Format,
+			SpecLenient:  options.Lenient,
+			Plans:        plans,
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode plan: %w", err)
+		}
+
+		if err := ioutil.WriteFile(outFile, planBytes, 0600); err != nil {
+			return fmt.Errorf("failed to write plan file %s: %w", outFile, err)
+		}
+
+		keyFile := hvc.FingerprintKeyFile(outFile)
+		if err := ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(copyJob.FingerprintKey)), 0600); err != nil {
+			return fmt.Errorf("failed to write fingerprint key file %s: %w", keyFile, err)
+		}
+
+		return nil
+	},
+}
+
+// outFile is set by the --out flag of the PlanCmd.
+var outFile string
+
+func init() {
+	PlanCmd.Flags().StringVarP(&outFile, "out", "o", "", "write the plan to this file so that it can be applied later")
+}
+
+// absPaths returns the absolute paths of the provided paths, so that the plan
+// file can be applied from any directory.
+func absPaths(paths []string) ([]string, error) {
+	absPaths := make([]string, len(paths))
+	for i, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine path of file %s: %w", path, err)
+		}
+
+		absPaths[i] = absPath
+	}
+
+	return absPaths, nil
+}
+
+// Run plans the provided copy job, writes the resulting plans to the provided
+// Writer, and closes the copy job.
+func Run(copyJob *hvc.CopyJob, out io.Writer) ([]*hvc.CopyPlan, error) {
+	plans, errorSlice := copyJob.Plan()
+
+	if err := copyJob.Close(); err != nil {
+		errorSlice = append(errorSlice, err)
+	}
+
+	WritePlans(out, plans)
+
+	if len(errorSlice) > 0 {
+		return nil, fmt.Errorf("failed to plan copies: %s", errorSlice)
+	}
+
+	return plans, nil
+}
+
+// WritePlans writes a human readable description of the provided plans to the
+// provided Writer. Secret values are never written, only the keys that would
+// change.
+func WritePlans(out io.Writer, plans []*hvc.CopyPlan) {
+	counts := make(map[hvc.PlanAction]int)
+
+	for _, plan := range plans {
+		if plan == nil {
+			continue
+		}
+
+		counts[plan.Action]++
+
+		fmt.Fprintf(out, "%s %s %s\n", actionSymbols[plan.Action], plan.Action, plan.Name)
+		for _, change := range plan.Changes {
+			fmt.Fprintf(out, "    %s %s (value redacted)\n", changeSymbols[change.Type], change.Key)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d to create, %d to update, %d to delete, %d to skip\n", counts[hvc.PlanActionCreate], counts[hvc.PlanActionUpdate], counts[hvc.PlanActionDelete], counts[hvc.PlanActionSkip])
+}
+
+var actionSymbols = map[hvc.PlanAction]string{
+	hvc.PlanActionCreate: "+",
+	hvc.PlanActionUpdate: "~",
+	hvc.PlanActionSkip:   "=",
+	hvc.PlanActionDelete: "-",
+}
+
+var changeSymbols = map[hvc.KeyChangeType]string{
+	hvc.KeyAdded:   "+",
+	hvc.KeyChanged: "~",
+	hvc.KeyRemoved: "-",
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/marcboudreau/hvc/cmd/internal/load"
+	"github.com/marcboudreau/hvc/spec"
+	"github.com/spf13/cobra"
+)
+
+// RenderCmd is the cobra.Command that handles the render option of this
+// application.
+var RenderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Prints the copy job specification once its files are merged and its overlays applied",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("missing copy job specification filenames")
+		}
+
+		options, err := load.Options()
+		if err != nil {
+			return err
+		}
+
+		// File references are left as-is, since the referenced files usually
+		// hold credentials.
+		options.KeepFileReferences = true
+
+		copyJob, _, err := spec.LoadSpecFiles(args, options)
+		if err != nil {
+			return err
+		}
+
+		redactCredentials(copyJob.Target)
+		for _, source := range copyJob.Sources {
+			redactCredentials(source)
+		}
+
+		specBytes, err := json.MarshalIndent(copyJob, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode copy job specification: %w", err)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), string(specBytes))
+
+		return nil
+	},
+}
+
+// redactedValue replaces the credentials of the rendered copy job
+// specification.
+const redactedValue = "(redacted)"
+
+// redactCredentials replaces the credentials found in the provided Vault
+// specification, which usually come from environment variables, unless they
+// are file or Vault references.
+func redactCredentials(vault *spec.Vault) {
+	if vault == nil || vault.Login == nil {
+		return
+	}
+
+	redact(&vault.Login.Token)
+
+	if vault.Login.AppRole != nil {
+		redact(&vault.Login.AppRole.SecretID)
+	}
+}
+
+// redact replaces the provided value with redactedValue, unless it's empty or
+// a reference.
+func redact(value *string) {
+	if *value == "" || strings.HasPrefix(*value, "${") {
+		return
+	}
+
+	*value = redactedValue
+}
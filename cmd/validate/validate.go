@@ -0,0 +1,49 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marcboudreau/hvc/cmd/internal/load"
+	"github.com/marcboudreau/hvc/spec"
+	"github.com/spf13/cobra"
+)
+
+// ValidateCmd is the cobra.Command that handles the validate option of this
+// application.
+var ValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks copy job specification files without connecting to any Vault server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return fmt.Errorf("missing copy job specification filenames")
+		}
+
+		options, err := load.Options()
+		if err != nil {
+			return err
+		}
+
+		validationErrors := spec.ValidateFiles(args, options)
+		for _, validationError := range validationErrors {
+			file := validationError.File
+			if file == "" {
+				file = strings.Join(args, ", ")
+			}
+
+			if validationError.Line == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s: %s\n", file, validationError.Path, validationError.Message)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s:%d: %s: %s\n", file, validationError.Line, validationError.Path, validationError.Message)
+			}
+		}
+
+		if len(validationErrors) > 0 {
+			return fmt.Errorf("copy job specification files %s have %d problems", strings.Join(args, ", "), len(validationErrors))
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", strings.Join(args, ", "))
+
+		return nil
+	},
+}
@@ -3,8 +3,13 @@ package hvc
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/marcboudreau/hvc/spec"
 )
 
@@ -18,6 +23,31 @@ type Copy struct {
 	// Path is the path of the target secret within the KV secrets engine.
 	Path string
 
+	// Namespace is the Vault Enterprise namespace of the target secret. When
+	// empty, the namespace of the target Vault connection is used.
+	Namespace string
+
+	// KVVersion is the version of the target secret's KV secrets engine. A
+	// value of 0 is treated as version 2.
+	KVVersion int
+
+	// Merge indicates that the copied keys are merged into the target secret,
+	// preserving its other keys, instead of overwriting it.
+	Merge bool
+
+	// RemoveUnmapped indicates that a merge removes the keys of the target
+	// secret that a previous merge copied but that are no longer copied.
+	RemoveUnmapped bool
+
+	// ConflictRetries is the number of times the copy is retried when the
+	// target secret is changed by another writer between the time its need
+	// to be updated is determined and the time it's written.
+	ConflictRetries int
+
+	// detectMount indicates that Path is a full logical path whose mount point
+	// must be detected.
+	detectMount bool
+
 	// SourceSecret is the CopySource, which defines what source secret values
 	// are used to update the target secret.
 	SourceSecret CopySource
@@ -36,9 +66,27 @@ func NewCopy(spec *spec.Copy, sources map[string]Vault) (*Copy, error) {
 		return nil, errors.New("copy element must provide a target secret path")
 	}
 
+	if err := validateKVVersion(spec.KVVersion); err != nil {
+		return nil, err
+	}
+
 	copy := &Copy{
-		MountPoint: targetMountPoint,
-		Path:       spec.Path,
+		MountPoint:  targetMountPoint,
+		Path:        spec.Path,
+		Namespace:   spec.Namespace,
+		KVVersion:   spec.KVVersion,
+		detectMount: spec.MountPoint == "",
+	}
+
+	if spec.ConflictRetries < 0 {
+		return nil, errors.New("conflict-retries cannot be negative")
+	}
+
+	copy.ConflictRetries = spec.ConflictRetries
+
+	if spec.Merge != nil {
+		copy.Merge = true
+		copy.RemoveUnmapped = spec.Merge.RemoveUnmapped
 	}
 
 	if spec.Secret != nil {
@@ -53,6 +101,15 @@ func NewCopy(spec *spec.Copy, sources map[string]Vault) (*Copy, error) {
 			return nil, fmt.Errorf("secret is referencing a non-existing source Vault %s", spec.Secret.Source)
 		}
 
+		vault, err := withNamespace(vault, spec.Secret.Namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateKVVersion(spec.Secret.KVVersion); err != nil {
+			return nil, err
+		}
+
 		sourceMountPoint := spec.Secret.MountPoint
 		if sourceMountPoint == "" {
 			sourceMountPoint = "kv"
@@ -65,9 +122,11 @@ func NewCopy(spec *spec.Copy, sources map[string]Vault) (*Copy, error) {
 
 		copy.SourceSecret = &CopySourceSecret{
 			secret: &CopyValue{
-				Source:     vault,
-				MountPoint: sourceMountPoint,
-				Path:       sourcePath,
+				Source:      vault,
+				MountPoint:  sourceMountPoint,
+				Path:        sourcePath,
+				KVVersion:   spec.Secret.KVVersion,
+				detectMount: spec.Secret.MountPoint == "",
 			},
 		}
 	} else {
@@ -78,6 +137,15 @@ func NewCopy(spec *spec.Copy, sources map[string]Vault) (*Copy, error) {
 				return nil, fmt.Errorf("secret value for target secret key %s is referencing a non-existing source Vault %s", k, v.Source)
 			}
 
+			sourceVault, err := withNamespace(sourceVault, v.Namespace)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := validateKVVersion(v.KVVersion); err != nil {
+				return nil, err
+			}
+
 			mountPoint := v.MountPoint
 			if v.MountPoint == "" {
 				mountPoint = "kv"
@@ -94,10 +162,12 @@ func NewCopy(spec *spec.Copy, sources map[string]Vault) (*Copy, error) {
 			}
 
 			copyValues[k] = &CopyValue{
-				Source:     sourceVault,
-				MountPoint: mountPoint,
-				Path:       path,
-				Key:        key,
+				Source:      sourceVault,
+				MountPoint:  mountPoint,
+				Path:        path,
+				Key:         key,
+				KVVersion:   v.KVVersion,
+				detectMount: v.MountPoint == "",
 			}
 		}
 
@@ -109,29 +179,216 @@ func NewCopy(spec *spec.Copy, sources map[string]Vault) (*Copy, error) {
 	return copy, nil
 }
 
+// withNamespace returns a Vault interface for the provided Vault connection
+// that dispatches its calls in the provided namespace. If the namespace is
+// empty, the Vault connection is returned as-is.
+func withNamespace(vault Vault, namespace string) (Vault, error) {
+	if namespace == "" {
+		return vault, nil
+	}
+
+	return vault.WithNamespace(namespace)
+}
+
+// validateKVVersion makes sure that the provided KV secrets engine version is
+// either 1, 2, or 0 when the version is to be detected.
+func validateKVVersion(version int) error {
+	if version < 0 || version > 2 {
+		return fmt.Errorf("unsupported KV version %d", version)
+	}
+
+	return nil
+}
+
+// ResolveMounts determines the mount point of the target secret and of every
+// source secret whose path is a full logical path, as well as the version of
+// every KV secrets engine involved, using the provided mountCache structure. A
+// full logical path that isn't contained in any mount keeps the default kv
+// mount point. So does a path whose secret exists in the default kv mount,
+// since such a path designated that secret before mount points were detected.
+func (p *Copy) ResolveMounts(target Vault, cache *mountCache) error {
+	return p.resolveMounts(target, cache, true)
+}
+
+// resolveMounts determines the mount points and KV versions like ResolveMounts
+// does. If keepExisting is false, the secrets aren't looked for in the default
+// kv mount, so every full logical path contained in a mount is resolved to it.
+func (p *Copy) resolveMounts(target Vault, cache *mountCache, keepExisting bool) error {
+	target, err := withNamespace(target, p.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if keepExisting {
+		if err := p.keepExistingSecrets(target, cache); err != nil {
+			return err
+		}
+	}
+
+	p.MountPoint, p.Path, p.KVVersion, err = resolveMount(target, cache, p.detectMount, p.MountPoint, p.Path, p.KVVersion)
+	if err != nil {
+		return err
+	}
+
+	p.detectMount = false
+
+	for _, value := range p.SourceSecret.sourceValues() {
+		value.MountPoint, value.Path, value.KVVersion, err = resolveMount(value.Source, cache, value.detectMount, value.MountPoint, value.Path, value.KVVersion)
+		if err != nil {
+			return err
+		}
+
+		value.detectMount = false
+	}
+
+	return nil
+}
+
+// resolveMount returns the mount point, path, and KV version of a secret. If
+// detectMount is true and the path has several segments, the path is resolved
+// as a full logical path. If the KV version is unknown, it's retrieved from
+// the mount.
+func resolveMount(vault Vault, cache *mountCache, detectMount bool, mountPoint, path string, version int) (string, string, int, error) {
+	// A single segment can't hold both a mount point and a secret path, so it
+	// keeps the default mount point without inspecting the Vault server.
+	if detectMount && strings.Contains(path, "/") {
+		detectedMountPoint, detectedPath, detectedVersion, found, err := cache.resolve(vault, path)
+		if err != nil {
+			return "", "", 0, err
+		}
+
+		if found {
+			if version == 0 {
+				version = detectedVersion
+			}
+
+			return detectedMountPoint, detectedPath, version, nil
+		}
+	}
+
+	if version == 0 {
+		detectedVersion, err := cache.version(vault, mountPoint)
+		if err != nil {
+			return "", "", 0, err
+		}
+
+		version = detectedVersion
+	}
+
+	return mountPoint, path, version, nil
+}
+
+// keepExistingSecrets keeps the default kv mount point for the target secret
+// and the source secrets whose paths are full logical paths, if those secrets
+// exist in the default kv mount.
+func (p *Copy) keepExistingSecrets(target Vault, cache *mountCache) error {
+	if p.detectMount {
+		held, err := defaultMountHolds(target, cache, p.Path)
+		if err != nil {
+			return err
+		}
+
+		p.detectMount = !held
+	}
+
+	for _, value := range p.SourceSecret.sourceValues() {
+		if !value.detectMount {
+			continue
+		}
+
+		held, err := defaultMountHolds(value.Source, cache, value.Path)
+		if err != nil {
+			return err
+		}
+
+		value.detectMount = !held
+	}
+
+	return nil
+}
+
+// defaultMountHolds determines if a secret exists at the provided path of the
+// default kv mount of the provided Vault server. A path with a single segment
+// always designates a secret of the default kv mount, so it isn't looked for.
+func defaultMountHolds(vault Vault, cache *mountCache, path string) (bool, error) {
+	if !strings.Contains(path, "/") {
+		return false, nil
+	}
+
+	mountPoint, _, version, found, err := cache.resolve(vault, "kv/"+path)
+	if err != nil || !found || mountPoint != "kv" {
+		return false, err
+	}
+
+	secret, err := vault.Read(kvDataPath(version, mountPoint, path))
+	if err != nil {
+		var responseError *vaultapi.ResponseError
+		if errors.As(err, &responseError) && responseError.StatusCode == http.StatusForbidden {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to look for secret %s/%s in %s: %w", mountPoint, path, vault.Name(), err)
+	}
+
+	return secret != nil, nil
+}
+
+// usesKVVersion1 determines if the target secret or any of the source secrets
+// is stored in a KV version 1 secrets engine, which keeps no metadata.
+func (p *Copy) usesKVVersion1() bool {
+	if p.KVVersion == 1 {
+		return true
+	}
+
+	for _, value := range p.SourceSecret.sourceValues() {
+		if value.KVVersion == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
 // TargetUpdateTime retrieves the updated_time value from the target secret's
 // metadata.
 func (p *Copy) TargetUpdateTime(target Vault) (time.Time, error) {
+	targetTime, _, err := p.targetMetadata(target)
+
+	return targetTime, err
+}
+
+// targetMetadata retrieves the updated_time and current_version values from
+// the target secret's metadata. The current_version value is 0 if the target
+// secret doesn't exist.
+func (p *Copy) targetMetadata(target Vault) (time.Time, int, error) {
 	// Get the metadata of the secret in the target Vault server
 	secret, err := target.Read(fmt.Sprintf("%s/metadata/%s", p.MountPoint, p.Path))
 	if err != nil {
-		return time.Unix(0, 0), fmt.Errorf("failed to retrieve target secret %q metadata: %w", p.Name(), err)
+		return time.Unix(0, 0), 0, fmt.Errorf("failed to retrieve target secret %q metadata: %w", p.Name(), err)
 	}
 
 	// If the secret in the target Vault server doesn't exist, secret will be nil
 	// and so will err.
 	if secret == nil {
-		return time.Unix(0, 0), nil
+		return time.Unix(0, 0), 0, nil
 	}
 
 	// Parse the retrieved time
 	updatedTime := secret.Data["updated_time"].(string)
 	targetTime, err := time.Parse(time.RFC3339Nano, updatedTime)
 	if err != nil {
-		return time.Unix(0, 0), fmt.Errorf("failed to parse the retrieved value for the updated_time %s: %w", updatedTime, err)
+		return time.Unix(0, 0), 0, fmt.Errorf("failed to parse the retrieved value for the updated_time %s: %w", updatedTime, err)
+	}
+
+	currentVersion := 0
+	if secret.Data["current_version"] != nil {
+		currentVersion, err = strconv.Atoi(fmt.Sprint(secret.Data["current_version"]))
+		if err != nil {
+			return time.Unix(0, 0), 0, fmt.Errorf("failed to parse current_version value %v: %w", secret.Data["current_version"], err)
+		}
 	}
 
-	return targetTime, nil
+	return targetTime, currentVersion, nil
 }
 
 // DetermineNeedToCopy retrieves the metadata for every source secret referenced
@@ -148,51 +405,173 @@ func (p *Copy) DetermineNeedToCopy(targetTime time.Time) (bool, error) {
 	return targetTime.Before(sourceTime), nil
 }
 
+// DetermineContentChanged retrieves the target secret's data and the source
+// values and compares them. If they differ, the function will return true,
+// otherwise it will return false. This comparison is used instead of the
+// updated_time comparison when a KV version 1 secrets engine is involved.
+func (p *Copy) DetermineContentChanged(target Vault) (bool, error) {
+	changed, _, err := p.contentChanged(target)
+
+	return changed, err
+}
+
+// contentChanged compares the target secret's data with the source values like
+// DetermineContentChanged, and also returns the version of the target secret
+// that was read, which is 0 in a KV version 1 secrets engine.
+func (p *Copy) contentChanged(target Vault) (bool, int, error) {
+	secret, err := target.Read(kvDataPath(p.KVVersion, p.MountPoint, p.Path))
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to retrieve target secret %q values: %w", p.Name(), err)
+	}
+
+	version := 0
+	if p.KVVersion != 1 {
+		version, err = kvDataVersion(secret)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to retrieve target secret %q version: %w", p.Name(), err)
+		}
+	}
+
+	sourceData, err := p.SourceSecret.RetrieveSourceValues()
+	if err != nil {
+		return false, 0, err
+	}
+
+	targetData := kvSecretData(p.KVVersion, secret)
+	if targetData == nil {
+		return true, version, nil
+	}
+
+	desiredData, err := p.desiredData(target, targetData, sourceData)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return !reflect.DeepEqual(targetData, desiredData), version, nil
+}
+
 // UpdateTargetSecret updates the target secret referenced in the receiver using
-// the provided target Vault interface.
-func (p *Copy) UpdateTargetSecret(target Vault) error {
+// the provided target Vault interface. In a KV version 2 secrets engine, the
+// target secret is written using check-and-set, so that it's only updated if
+// its current version is still the provided version, which was observed when
+// its need to be updated was determined. Otherwise, an error wrapping
+// ErrTargetConflict is returned.
+func (p *Copy) UpdateTargetSecret(target Vault, version int) error {
 	targetData, err := p.SourceSecret.RetrieveSourceValues()
 	if err != nil {
 		return err
 	}
 
-	_, err = target.Write(fmt.Sprintf("%s/data/%s", p.MountPoint, p.Path), map[string]interface{}{"data": targetData})
+	if p.Merge {
+		return p.mergeTargetSecret(target, targetData, version)
+	}
+
+	_, err = target.Write(kvDataPath(p.KVVersion, p.MountPoint, p.Path), p.checkAndSet(kvWriteData(p.KVVersion, targetData), version))
 	if err != nil {
-		return fmt.Errorf("failed to update target secret %q: %w", p.Name(), err)
+		return p.writeError(err)
 	}
 
 	return nil
 }
 
+// checkAndSet adds the check-and-set option with the provided version to the
+// provided request body, unless the target secret is stored in a KV version 1
+// secrets engine, which doesn't support it.
+func (p *Copy) checkAndSet(data map[string]interface{}, version int) map[string]interface{} {
+	if p.KVVersion != 1 {
+		data["options"] = map[string]interface{}{"cas": version}
+	}
+
+	return data
+}
+
+// writeError wraps the provided error returned when writing the target secret.
+// A check-and-set mismatch is reported with ErrTargetConflict.
+func (p *Copy) writeError(err error) error {
+	if isCheckAndSetMismatch(err) {
+		return fmt.Errorf("failed to update target secret %q: %w", p.Name(), ErrTargetConflict)
+	}
+
+	return fmt.Errorf("failed to update target secret %q: %w", p.Name(), err)
+}
+
 // Name returns a canonical name for the receiver.
 func (p *Copy) Name() string {
-	return fmt.Sprintf("%s/%s", p.MountPoint, p.Path)
+	return secretName(p.Namespace, p.MountPoint, p.Path)
+}
+
+// secretName returns the canonical name of the target secret at the provided
+// path of the KV secrets engine mounted at the provided mount point, in the
+// provided namespace.
+func secretName(namespace, mountPoint, path string) string {
+	if namespace != "" {
+		return fmt.Sprintf("%s/%s/%s", namespace, mountPoint, path)
+	}
+
+	return fmt.Sprintf("%s/%s", mountPoint, path)
+}
+
+// determineNeedToUpdate determines whether the target secret needs to be
+// updated. The updated_time values of the target and source secrets are
+// compared, unless a KV version 1 secrets engine is involved or the receiver
+// merges, in which case the contents of the secrets are compared. A merged
+// target secret is also written by others, so it can be more recent than its
+// source secrets and still lack their changes. The version of the target
+// secret that was observed is also returned, so that it can be used to
+// check-and-set.
+func (p *Copy) determineNeedToUpdate(target Vault) (bool, int, error) {
+	if p.usesKVVersion1() || p.Merge {
+		return p.contentChanged(target)
+	}
+
+	// Get the metadata of the secret in the target Vault server
+	targetTime, version, err := p.targetMetadata(target)
+	if err != nil {
+		return false, 0, err
+	}
+
+	needsCopy, err := p.DetermineNeedToCopy(targetTime)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return needsCopy, version, nil
 }
 
 // Execute executes the copy operation of the receiver using the provided target
 // Vault interface. The function uses the provided index and channel to report
-// any errors encountered.
+// any errors encountered. When the target secret is changed by another writer
+// during the copy operation, the copy operation is retried up to
+// ConflictRetries times.
 func (p *Copy) Execute(target Vault, index int, ch chan error) {
-	// Get the metadata of the secret in the target Vault server
-	targetTime, err := p.TargetUpdateTime(target)
+	target, err := withNamespace(target, p.Namespace)
 	if err != nil {
 		ch <- fmt.Errorf("failed to execute copy %d: %w", index, err)
 		return
 	}
 
-	needsUpdate, err := p.DetermineNeedToCopy(targetTime)
+	for attempt := 0; ; attempt++ {
+		err = p.update(target)
+		if !errors.Is(err, ErrTargetConflict) || attempt >= p.ConflictRetries {
+			break
+		}
+	}
+
 	if err != nil {
 		ch <- fmt.Errorf("failed to execute copy %d: %w", index, err)
 		return
 	}
 
-	if needsUpdate {
-		err = p.UpdateTargetSecret(target)
-		if err != nil {
-			ch <- fmt.Errorf("failed to execute copy %d: %w", index, err)
-			return
-		}
+	ch <- nil
+}
+
+// update updates the target secret referenced in the receiver using the
+// provided target Vault interface, if it needs to be updated.
+func (p *Copy) update(target Vault) error {
+	needsUpdate, version, err := p.determineNeedToUpdate(target)
+	if err != nil || !needsUpdate {
+		return err
 	}
 
-	ch <- nil
+	return p.UpdateTargetSecret(target, version)
 }
@@ -1,6 +1,7 @@
 package hvc
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
@@ -774,7 +775,7 @@ func TestUpdateTargetSecret(t *testing.T) {
 			errorAssert: assert.Error,
 		},
 	} {
-		testcase.errorAssert(t, testcase.copy.UpdateTargetSecret(testcase.targetVault))
+		testcase.errorAssert(t, testcase.copy.UpdateTargetSecret(testcase.targetVault, 0))
 	}
 }
 
@@ -838,3 +839,423 @@ func TestCopyCantContainSecretAndValues(t *testing.T) {
 		testcase.copyAssert(t, copy)
 	}
 }
+
+func TestNewCopyAppliesSourceNamespace(t *testing.T) {
+	fakeVault := &FakeVault{
+		name: "fake",
+	}
+	copy, err := NewCopy(&spec.Copy{
+		Path:      "p1",
+		Namespace: "target-ns",
+		Secret: &spec.CopyValue{
+			Source:    "s1",
+			Namespace: "source-ns",
+		},
+	}, map[string]Vault{
+		"s1": fakeVault,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "target-ns", copy.Namespace)
+	assert.Equal(t, "target-ns/kv/p1", copy.Name())
+	assert.Equal(t, "source-ns", fakeVault.namespace)
+}
+
+func TestCopyExecuteWithKVVersion1(t *testing.T) {
+	for _, testcase := range []struct {
+		targetData     map[string]interface{}
+		expectedWrites int
+	}{
+		// Target content differs from source content
+		{
+			targetData:     map[string]interface{}{"k1": "old"},
+			expectedWrites: 1,
+		},
+		// Target content matches source content
+		{
+			targetData:     map[string]interface{}{"k1": "value"},
+			expectedWrites: 0,
+		},
+	} {
+		target := &FakeVault{
+			name: "_target",
+			readResponses: []FakeVaultResponse{
+				{
+					secret: &vault.Secret{
+						Data: testcase.targetData,
+					},
+				},
+			},
+			writeResponses: []FakeVaultResponse{
+				{
+					secret: &vault.Secret{},
+				},
+			},
+		}
+
+		source := &FakeVault{
+			name: "s1",
+			readResponses: []FakeVaultResponse{
+				// data read for the comparison
+				{
+					secret: &vault.Secret{
+						Data: map[string]interface{}{
+							"data": map[string]interface{}{"k1": "value"},
+						},
+					},
+				},
+				// data read for the update
+				{
+					secret: &vault.Secret{
+						Data: map[string]interface{}{
+							"data": map[string]interface{}{"k1": "value"},
+						},
+					},
+				},
+			},
+		}
+
+		copy := &Copy{
+			MountPoint: "secret",
+			Path:       "p1",
+			KVVersion:  1,
+			SourceSecret: &CopySourceSecret{
+				secret: &CopyValue{
+					Source:     source,
+					MountPoint: "kv",
+					Path:       "p1",
+					KVVersion:  2,
+				},
+			},
+		}
+
+		ch := make(chan error, 1)
+		copy.Execute(target, 0, ch)
+		assert.NoError(t, <-ch)
+		assert.Equal(t, []string{"secret/p1"}, target.reads)
+		assert.Len(t, target.writes, testcase.expectedWrites)
+		if testcase.expectedWrites > 0 {
+			assert.Equal(t, "secret/p1", target.writes[0].path)
+			assert.Equal(t, map[string]interface{}{"k1": "value"}, target.writes[0].data)
+		}
+	}
+}
+
+func TestCopyResolveMounts(t *testing.T) {
+	target := &FakeVault{
+		name: "_target",
+		readResponses: []FakeVaultResponse{
+			// The default kv mount contains the target path...
+			{
+				secret: &vault.Secret{
+					Data: map[string]interface{}{
+						"path":    "kv/",
+						"type":    "kv",
+						"options": map[string]interface{}{"version": "2"},
+					},
+				},
+			},
+			// ...but holds no secret there.
+			{},
+			// No mount contains the target path, so the kv default is kept.
+			{
+				err: &vault.ResponseError{StatusCode: 403},
+			},
+		},
+	}
+	source := &FakeVault{
+		name: "s1",
+		readResponses: []FakeVaultResponse{
+			// The source has no default kv mount.
+			{
+				err: &vault.ResponseError{StatusCode: 403},
+			},
+			{
+				secret: &vault.Secret{
+					Data: map[string]interface{}{
+						"path": "legacy/",
+						"type": "kv",
+					},
+				},
+			},
+		},
+	}
+
+	copy, err := NewCopy(&spec.Copy{
+		Path: "team/app",
+		Secret: &spec.CopyValue{
+			Source: "s1",
+			Path:   "legacy/team/app",
+		},
+	}, map[string]Vault{"s1": source})
+	assert.NoError(t, err)
+	assert.NoError(t, copy.ResolveMounts(target, newMountCache()))
+
+	assert.Equal(t, "kv", copy.MountPoint)
+	assert.Equal(t, "team/app", copy.Path)
+	assert.Equal(t, 2, copy.KVVersion)
+	assert.Equal(t, []string{"sys/internal/ui/mounts/kv/team/app", "kv/data/team/app", "sys/internal/ui/mounts/team/app"}, target.reads)
+
+	secret := copy.SourceSecret.(*CopySourceSecret).secret
+	assert.Equal(t, "legacy", secret.MountPoint)
+	assert.Equal(t, "team/app", secret.Path)
+	assert.Equal(t, 1, secret.KVVersion)
+	assert.Equal(t, []string{"sys/internal/ui/mounts/kv/legacy/team/app", "sys/internal/ui/mounts/legacy/team/app"}, source.reads)
+}
+
+func TestCopyResolveMountsExistingDefaultSecret(t *testing.T) {
+	kvMount := FakeVaultResponse{
+		secret: &vault.Secret{
+			Data: map[string]interface{}{
+				"path":    "kv/",
+				"type":    "kv",
+				"options": map[string]interface{}{"version": "2"},
+			},
+		},
+	}
+	teamMount := FakeVaultResponse{
+		secret: &vault.Secret{
+			Data: map[string]interface{}{
+				"path":    "team-a/",
+				"type":    "kv",
+				"options": map[string]interface{}{"version": "1"},
+			},
+		},
+	}
+
+	for _, testcase := range []struct {
+		readResponses      []FakeVaultResponse
+		expectedMountPoint string
+		expectedPath       string
+		expectedKVVersion  int
+		expectedReads      []string
+	}{
+		// A secret of the default kv mount keeps being copied to, even if
+		// another mount contains its path.
+		{
+			readResponses: []FakeVaultResponse{
+				kvMount,
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "value"}}}},
+			},
+			expectedMountPoint: "kv",
+			expectedPath:       "team-a/db",
+			expectedKVVersion:  2,
+			expectedReads:      []string{"sys/internal/ui/mounts/kv/team-a/db", "kv/data/team-a/db"},
+		},
+		// Without such a secret, the mount that contains the path is used.
+		{
+			readResponses:      []FakeVaultResponse{kvMount, {}, teamMount},
+			expectedMountPoint: "team-a",
+			expectedPath:       "db",
+			expectedKVVersion:  1,
+			expectedReads:      []string{"sys/internal/ui/mounts/kv/team-a/db", "kv/data/team-a/db", "sys/internal/ui/mounts/team-a/db"},
+		},
+		// A token that can't read the default kv mount can't tell the secret
+		// exists.
+		{
+			readResponses:      []FakeVaultResponse{kvMount, {err: &vault.ResponseError{StatusCode: 403}}, teamMount},
+			expectedMountPoint: "team-a",
+			expectedPath:       "db",
+			expectedKVVersion:  1,
+			expectedReads:      []string{"sys/internal/ui/mounts/kv/team-a/db", "kv/data/team-a/db", "sys/internal/ui/mounts/team-a/db"},
+		},
+	} {
+		target := &FakeVault{name: "_target", readResponses: testcase.readResponses}
+
+		copy, err := NewCopy(&spec.Copy{
+			Path:   "team-a/db",
+			Secret: &spec.CopyValue{Source: "s1", MountPoint: "kv", KVVersion: 2},
+		}, map[string]Vault{"s1": &FakeVault{name: "s1"}})
+		assert.NoError(t, err)
+		assert.NoError(t, copy.ResolveMounts(target, newMountCache()))
+
+		assert.Equal(t, testcase.expectedMountPoint, copy.MountPoint)
+		assert.Equal(t, testcase.expectedPath, copy.Path)
+		assert.Equal(t, testcase.expectedKVVersion, copy.KVVersion)
+		assert.Equal(t, testcase.expectedReads, target.reads)
+	}
+}
+
+func TestCopyResolveMountsSingleSegment(t *testing.T) {
+	target := &FakeVault{
+		name: "_target",
+		readResponses: []FakeVaultResponse{
+			// KV version of the default kv mount
+			{
+				secret: &vault.Secret{
+					Data: map[string]interface{}{
+						"type":    "kv",
+						"options": map[string]interface{}{"version": "2"},
+					},
+				},
+			},
+		},
+	}
+
+	copy, err := NewCopy(&spec.Copy{
+		Path:   "app",
+		Secret: &spec.CopyValue{Source: "s1", MountPoint: "kv", KVVersion: 2},
+	}, map[string]Vault{"s1": &FakeVault{name: "s1"}})
+	assert.NoError(t, err)
+	assert.NoError(t, copy.ResolveMounts(target, newMountCache()))
+
+	assert.Equal(t, "kv", copy.MountPoint)
+	assert.Equal(t, "app", copy.Path)
+	assert.Equal(t, []string{"sys/internal/ui/mounts/kv"}, target.reads)
+}
+
+func TestUpdateTargetSecretCheckAndSet(t *testing.T) {
+	for _, testcase := range []struct {
+		kvVersion      int
+		writeResponse  FakeVaultResponse
+		expectedData   map[string]interface{}
+		expectedError  string
+		expectConflict bool
+	}{
+		// Check-and-set in a KV version 2 secrets engine
+		{
+			kvVersion:     2,
+			writeResponse: FakeVaultResponse{secret: &vault.Secret{}},
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"k1": "v1"},
+				"options": map[string]interface{}{"cas": 3},
+			},
+		},
+		// No check-and-set in a KV version 1 secrets engine
+		{
+			kvVersion:     1,
+			writeResponse: FakeVaultResponse{secret: &vault.Secret{}},
+			expectedData:  map[string]interface{}{"k1": "v1"},
+		},
+		// Conflict
+		{
+			kvVersion: 2,
+			writeResponse: FakeVaultResponse{err: &vault.ResponseError{
+				StatusCode: 400,
+				Errors:     []string{"check-and-set parameter did not match the current version"},
+			}},
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"k1": "v1"},
+				"options": map[string]interface{}{"cas": 3},
+			},
+			expectedError:  `failed to update target secret "kv/p1": target secret was changed by another writer since it was checked`,
+			expectConflict: true,
+		},
+		// Other error
+		{
+			kvVersion:     2,
+			writeResponse: FakeVaultResponse{err: errors.New("permission denied")},
+			expectedData: map[string]interface{}{
+				"data":    map[string]interface{}{"k1": "v1"},
+				"options": map[string]interface{}{"cas": 3},
+			},
+			expectedError: `failed to update target secret "kv/p1": permission denied`,
+		},
+	} {
+		target := &FakeVault{
+			name:           "target",
+			writeResponses: []FakeVaultResponse{testcase.writeResponse},
+		}
+
+		copy := &Copy{
+			MountPoint: "kv",
+			Path:       "p1",
+			KVVersion:  testcase.kvVersion,
+			SourceSecret: &CopySourceSecret{
+				secret: &CopyValue{
+					Source: &FakeVault{
+						name:          "s1",
+						readResponses: []FakeVaultResponse{{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v1"}}}},
+					},
+					MountPoint: "kv",
+					Path:       "p1",
+					KVVersion:  1,
+				},
+			},
+		}
+
+		err := copy.UpdateTargetSecret(target, 3)
+		if testcase.expectedError != "" {
+			assert.EqualError(t, err, testcase.expectedError)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, testcase.expectConflict, errors.Is(err, ErrTargetConflict))
+		assert.Equal(t, testcase.expectedData, target.writes[0].data)
+	}
+}
+
+func TestCopyExecuteConflictRetries(t *testing.T) {
+	conflict := FakeVaultResponse{err: &vault.ResponseError{
+		StatusCode: 400,
+		Errors:     []string{"check-and-set parameter did not match the current version"},
+	}}
+
+	targetMetadata := func(version string) FakeVaultResponse {
+		return FakeVaultResponse{secret: &vault.Secret{Data: map[string]interface{}{
+			"updated_time":    "2022-04-08T13:01:34.000000000Z",
+			"current_version": json.Number(version),
+		}}}
+	}
+
+	sourceMetadata := FakeVaultResponse{secret: &vault.Secret{Data: map[string]interface{}{"updated_time": "2022-04-09T13:01:34.000000000Z"}}}
+	sourceData := FakeVaultResponse{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}}
+
+	for _, testcase := range []struct {
+		conflictRetries int
+		writeResponses  []FakeVaultResponse
+		expectedCAS     []int
+		expectConflict  bool
+	}{
+		// Retried once
+		{
+			conflictRetries: 1,
+			writeResponses:  []FakeVaultResponse{conflict, {secret: &vault.Secret{}}},
+			expectedCAS:     []int{3, 4},
+		},
+		// Not retried
+		{
+			writeResponses: []FakeVaultResponse{conflict},
+			expectedCAS:    []int{3},
+			expectConflict: true,
+		},
+	} {
+		target := &FakeVault{
+			name:           "target",
+			readResponses:  []FakeVaultResponse{targetMetadata("3"), targetMetadata("4")},
+			writeResponses: testcase.writeResponses,
+		}
+
+		copy := &Copy{
+			MountPoint:      "kv",
+			Path:            "p1",
+			KVVersion:       2,
+			ConflictRetries: testcase.conflictRetries,
+			SourceSecret: &CopySourceSecret{
+				secret: &CopyValue{
+					Source: &FakeVault{
+						name:          "s1",
+						readResponses: []FakeVaultResponse{sourceMetadata, sourceData, sourceMetadata, sourceData},
+					},
+					MountPoint: "kv",
+					Path:       "p1",
+					KVVersion:  2,
+				},
+			},
+		}
+
+		ch := make(chan error, 1)
+		copy.Execute(target, 0, ch)
+		err := <-ch
+
+		assert.Equal(t, testcase.expectConflict, errors.Is(err, ErrTargetConflict))
+
+		cas := []int{}
+		for _, write := range target.writes {
+			cas = append(cas, write.data["options"].(map[string]interface{})["cas"].(int))
+		}
+
+		assert.Equal(t, testcase.expectedCAS, cas)
+	}
+}
@@ -1,7 +1,10 @@
 package hvc
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/marcboudreau/hvc/spec"
@@ -14,49 +17,236 @@ type CopyJob struct {
 	// Target specifies the connection to the target Vault server.
 	Target Vault
 
+	// Sources is a map of source names to connections to the source Vault
+	// servers.
+	Sources map[string]Vault
+
 	// Copies is an array of Copy objects that define what needs to be copied
 	// to the target Vault server.
 	Copies []*Copy
+
+	// Prunes is an array of Prune objects that define which target secrets
+	// need to be deleted from the target Vault server by mirrors.
+	Prunes []*Prune
+
+	// FingerprintKey is the key used to compute the fingerprints of the
+	// secrets stored in KV version 1 secrets engines when planning and
+	// applying. It must never be stored with the plans.
+	FingerprintKey []byte
 }
 
 // NewCopyJob creates a CopyJob structure using the data in the provided
-// CopyJobSpec object.
+// CopyJobSpec object. A copy with a prefix is expanded into a Copy structure
+// per secret found under its source prefix, so the Copies field of the
+// resulting CopyJob structure can hold more elements than the CopyJobSpec
+// object. The Vault references found in the provided CopyJobSpec
+// object are resolved as soon as the source Vault they reference is
+// connected.
 func NewCopyJob(spec *spec.CopyJob) (*CopyJob, error) {
-	copyJob := &CopyJob{}
+	copyJob := &CopyJob{
+		Sources: make(map[string]Vault),
+	}
+
+	mounts := newMountCache()
+
+	if err := copyJob.connectSources(spec.Sources, mounts); err != nil {
+		copyJob.Close()
+		return nil, err
+	}
+
+	if err := copyJob.resolveVaultReferences(spec.Target, mounts); err != nil {
+		copyJob.Close()
+		return nil, fmt.Errorf("failed to initialize target Vault: %w", err)
+	}
 
 	targetVault, err := NewVault(spec.Target, "_target")
 	if err != nil {
+		copyJob.Close()
 		return nil, fmt.Errorf("failed to initialize target Vault: %w", err)
 	}
 
 	copyJob.Target = targetVault
 
-	sourceVaults := make(map[string]Vault)
-	for sourceVaultKey, sourceVaultSpec := range spec.Sources {
-		sourceVault, err := NewVault(sourceVaultSpec, sourceVaultKey)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize source Vault %q: %w", sourceVaultKey, err)
+	copyJob.Copies = make([]*Copy, 0, len(spec.Copies))
+	for i, copySpec := range spec.Copies {
+		if err := copyJob.resolveVaultReferences(copySpec, mounts); err != nil {
+			copyJob.Close()
+			return nil, fmt.Errorf("failed to resolve copy %d: %w", i+1, err)
 		}
 
-		sourceVaults[sourceVaultKey] = sourceVault
-	}
+		// A copy with a prefix is replaced by a copy of every secret found
+		// under its source prefix.
+		if copySpec.IsPrefix() {
+			copies, prunes, err := copyJob.expandPrefixCopy(copySpec, mounts)
+			if err != nil {
+				copyJob.Close()
+				return nil, fmt.Errorf("failed to resolve copy %d: %w", i+1, err)
+			}
 
-	copyJob.Copies = make([]*Copy, len(spec.Copies))
-	for i, copySpec := range spec.Copies {
-		copy, err := NewCopy(copySpec, sourceVaults)
+			copyJob.Copies = append(copyJob.Copies, copies...)
+			copyJob.Prunes = append(copyJob.Prunes, prunes...)
+			continue
+		}
+
+		copy, err := NewCopy(copySpec, copyJob.Sources)
 		if err != nil {
+			copyJob.Close()
 			return nil, fmt.Errorf("failed to resolve copy %d: %w", i+1, err)
 		}
 
-		copyJob.Copies[i] = copy
+		if err := copy.ResolveMounts(copyJob.Target, mounts); err != nil {
+			copyJob.Close()
+			return nil, fmt.Errorf("failed to resolve copy %d: %w", i+1, err)
+		}
+
+		copyJob.Copies = append(copyJob.Copies, copy)
 	}
 
+	copyJob.keepCopiedTargets()
+
 	return copyJob, nil
 }
 
+// keepCopiedTargets removes the Prune objects of the receiver whose target
+// secret is written by any of its copies, such as a copy of another prefix.
+func (p *CopyJob) keepCopiedTargets() {
+	if len(p.Prunes) == 0 {
+		return
+	}
+
+	copied := make(map[string]bool)
+	for _, copy := range p.Copies {
+		copied[copy.Name()] = true
+	}
+
+	prunes := []*Prune{}
+	for _, prune := range p.Prunes {
+		if !copied[prune.Name()] {
+			prunes = append(prunes, prune)
+		}
+	}
+
+	p.Prunes = prunes
+}
+
+// errSourceNotConnected is returned when a Vault reference refers to a source
+// Vault that isn't connected yet.
+var errSourceNotConnected = errors.New("source Vault is not connected yet")
+
+// connectSources connects the source Vaults of the provided map of source
+// names to spec.Vault objects. Since a source Vault spec can contain Vault
+// references to other source Vaults, each source Vault is connected once every
+// source Vault it references is connected.
+func (p *CopyJob) connectSources(sources map[string]*spec.Vault, mounts *mountCache) error {
+	pending := make([]string, 0, len(sources))
+	for name := range sources {
+		pending = append(pending, name)
+	}
+
+	sort.Strings(pending)
+
+	for len(pending) > 0 {
+		waiting := []string{}
+
+		for _, name := range pending {
+			err := spec.ResolveReferences(sources[name], spec.VaultReference, func(reference string) (string, error) {
+				return p.resolveVaultReference(reference, mounts, sources)
+			})
+			if errors.Is(err, errSourceNotConnected) {
+				waiting = append(waiting, name)
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to initialize source Vault %q: %w", name, err)
+			}
+
+			sourceVault, err := NewVault(sources[name], name)
+			if err != nil {
+				return fmt.Errorf("failed to initialize source Vault %q: %w", name, err)
+			}
+
+			p.Sources[name] = sourceVault
+		}
+
+		if len(waiting) == len(pending) {
+			return fmt.Errorf("failed to initialize source Vaults %s: their Vault references form a cycle", strings.Join(waiting, ", "))
+		}
+
+		pending = waiting
+	}
+
+	return nil
+}
+
+// resolveVaultReferences replaces the Vault references found in the provided
+// spec structure with the values they designate in the connected source
+// Vaults.
+func (p *CopyJob) resolveVaultReferences(value interface{}, mounts *mountCache) error {
+	return spec.ResolveReferences(value, spec.VaultReference, func(reference string) (string, error) {
+		return p.resolveVaultReference(reference, mounts, nil)
+	})
+}
+
+// resolveVaultReference reads the value designated by the provided Vault
+// reference, written as source-name:mount/path#key, from the referenced source
+// Vault. The mount point of the secret is detected from its full logical path.
+// If the referenced source Vault isn't connected yet, but is part of the
+// provided map of source specs, errSourceNotConnected is returned.
+func (p *CopyJob) resolveVaultReference(reference string, mounts *mountCache, pending map[string]*spec.Vault) (string, error) {
+	sourceName, fullPath, key, err := spec.ParseVaultReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	source, found := p.Sources[sourceName]
+	if !found {
+		if _, found := pending[sourceName]; found {
+			return "", fmt.Errorf("failed to resolve Vault reference to %s: %w", sourceName, errSourceNotConnected)
+		}
+
+		return "", fmt.Errorf("reference to non-existing source Vault %s", sourceName)
+	}
+
+	mountPoint, path, version, err := resolveMount(source, mounts, true, "kv", fullPath, 0)
+	if err != nil {
+		return "", err
+	}
+
+	value := &CopyValue{
+		Source:     source,
+		MountPoint: mountPoint,
+		Path:       path,
+		Key:        key,
+		KVVersion:  version,
+	}
+
+	secret, err := source.Read(kvDataPath(version, mountPoint, path))
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve referenced secret %q values: %w", value.Name(), err)
+	}
+
+	data := kvSecretData(version, secret)
+	if data == nil {
+		return "", fmt.Errorf("referenced secret %q does not exist", value.Name())
+	}
+
+	referencedValue, found := data[key]
+	if !found {
+		return "", fmt.Errorf("missing key %s in referenced secret %q", key, value.Name())
+	}
+
+	if stringValue, ok := referencedValue.(string); ok {
+		return stringValue, nil
+	}
+
+	return fmt.Sprint(referencedValue), nil
+}
+
 // Execute copies the secret values referenced in the provided Copy
 // structure using the receiver's configured target and source Vault
-// connections.
+// connections. Once every copy succeeded, the target secrets of the Prune
+// objects are deleted.
 func (p *CopyJob) Execute() []error {
 	ch := make(chan error)
 
@@ -78,5 +268,38 @@ func (p *CopyJob) Execute() []error {
 		}
 	}
 
-	return errorSlice
+	// Target secrets are only deleted once every copy succeeded, so that a
+	// failure never leaves the target with fewer secrets than expected.
+	if len(errorSlice) > 0 {
+		return errorSlice
+	}
+
+	return p.executePrunes()
+}
+
+// Close closes the receiver's target and source Vault connections, which
+// revokes the Vault tokens obtained by this application. Every connection is
+// closed even if some of them fail, and the errors encountered are combined.
+func (p *CopyJob) Close() error {
+	vaults := []Vault{}
+	if p.Target != nil {
+		vaults = append(vaults, p.Target)
+	}
+
+	for _, source := range p.Sources {
+		vaults = append(vaults, source)
+	}
+
+	errorSlice := []error{}
+	for _, vault := range vaults {
+		if err := vault.Close(); err != nil {
+			errorSlice = append(errorSlice, err)
+		}
+	}
+
+	if len(errorSlice) > 0 {
+		return fmt.Errorf("failed to close Vault connections: %s", errorSlice)
+	}
+
+	return nil
 }
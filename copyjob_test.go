@@ -1,7 +1,9 @@
 package hvc
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
 	"testing"
 
 	vault "github.com/hashicorp/vault/api"
@@ -36,12 +38,14 @@ func TestNewCopyJob(t *testing.T) {
 					{
 						MountPoint: "kv",
 						Path:       "p1",
+						KVVersion:  2,
 						Values: map[string]*spec.CopyValue{
 							"t1": {
 								Source:     "s1",
 								MountPoint: "kv",
 								Path:       "p1",
 								Key:        "k1",
+								KVVersion:  2,
 							},
 						},
 					},
@@ -631,3 +635,89 @@ func TestCopyJobExecute(t *testing.T) {
 		testcase.errorSliceAssert(t, testcase.copyJob.Execute())
 	}
 }
+
+func TestCopyJobClose(t *testing.T) {
+	target := &FakeVault{name: "_target"}
+	source := &FakeVault{name: "s1"}
+
+	copyJob := &CopyJob{
+		Target: target,
+		Sources: map[string]Vault{
+			"s1": source,
+		},
+	}
+
+	assert.NoError(t, copyJob.Close())
+	assert.True(t, target.closed)
+	assert.True(t, source.closed)
+}
+
+func TestNewCopyJobVaultReferences(t *testing.T) {
+	respond := func(token string, body map[string]interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != token {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			json.NewEncoder(w).Encode(body)
+		}
+	}
+
+	serverA := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/sys/internal/ui/mounts/secret/tokens": respond("a-token", map[string]interface{}{
+			"data": map[string]interface{}{"path": "secret/", "type": "kv", "options": map[string]interface{}{"version": "2"}},
+		}),
+		"/v1/secret/data/tokens": respond("a-token", map[string]interface{}{
+			"data": map[string]interface{}{"data": map[string]interface{}{"b": "b-token"}},
+		}),
+	})
+
+	serverB := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/sys/internal/ui/mounts/kv/tokens": respond("b-token", map[string]interface{}{
+			"data": map[string]interface{}{"path": "kv/", "type": "kv", "options": map[string]interface{}{"version": "1"}},
+		}),
+		"/v1/kv/tokens": respond("b-token", map[string]interface{}{
+			"data": map[string]interface{}{"target": "target-token"},
+		}),
+	})
+
+	copyJob, err := NewCopyJob(&spec.CopyJob{
+		Target: &spec.Vault{
+			Address: serverA.URL,
+			Login:   &spec.VaultLogin{Token: "${vault:b:kv/tokens#target}"},
+		},
+		Sources: map[string]*spec.Vault{
+			// b is connected after a, since it references a.
+			"b": {
+				Address: serverB.URL,
+				Login:   &spec.VaultLogin{Token: "${vault:a:secret/tokens#b}"},
+			},
+			"a": {
+				Address: serverA.URL,
+				Login:   &spec.VaultLogin{Token: "a-token"},
+			},
+		},
+		Copies: []*spec.Copy{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "target-token", copyJob.Target.(*realVault).client.Token())
+	assert.Equal(t, "b-token", copyJob.Sources["b"].(*realVault).client.Token())
+
+	// Sources referencing each other
+	_, err = NewCopyJob(&spec.CopyJob{
+		Target: &spec.Vault{Address: serverA.URL, Login: &spec.VaultLogin{Token: "a-token"}},
+		Sources: map[string]*spec.Vault{
+			"a": {Address: serverA.URL, Login: &spec.VaultLogin{Token: "${vault:b:secret/tokens#a}"}},
+			"b": {Address: serverB.URL, Login: &spec.VaultLogin{Token: "${vault:a:secret/tokens#b}"}},
+		},
+	})
+	assert.EqualError(t, err, "failed to initialize source Vaults a, b: their Vault references form a cycle")
+
+	// Reference to an undefined source
+	_, err = NewCopyJob(&spec.CopyJob{
+		Target:  &spec.Vault{Address: serverA.URL, Login: &spec.VaultLogin{Token: "${vault:c:secret/tokens#b}"}},
+		Sources: map[string]*spec.Vault{},
+	})
+	assert.EqualError(t, err, "failed to initialize target Vault: reference to non-existing source Vault c")
+}
@@ -11,6 +11,7 @@ import (
 type CopySource interface {
 	DetermineUpdatedTime() (time.Time, error)
 	RetrieveSourceValues() (map[string]interface{}, error)
+	sourceValues() []*CopyValue
 }
 
 // CopySourceValues implements the CopySource interface and uses a map of
@@ -48,6 +49,14 @@ type CopyValue struct {
 	// Key is the key of the value in the source secret that should be copied to
 	// the target secret.
 	Key string
+
+	// KVVersion is the version of the KV secrets engine mounted at MountPoint.
+	// A value of 0 is treated as version 2.
+	KVVersion int
+
+	// detectMount indicates that Path is a full logical path whose mount point
+	// must be detected.
+	detectMount bool
 }
 
 // Name returns a canonical name for the receiver.
@@ -55,6 +64,22 @@ func (p *CopyValue) Name() string {
 	return fmt.Sprintf("%s: %s/%s", p.Source.Name(), p.MountPoint, p.Path)
 }
 
+// isDeleted determines if the latest version of the receiver's source secret
+// is deleted or destroyed. Such secrets are still listed in a KV version 2
+// secrets engine, because their metadata is kept.
+func (p *CopyValue) isDeleted() (bool, error) {
+	if p.KVVersion == 1 {
+		return false, nil
+	}
+
+	secret, err := p.Source.Read(kvDataPath(p.KVVersion, p.MountPoint, p.Path))
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve source secret %q values: %w", p.Name(), err)
+	}
+
+	return kvSecretData(p.KVVersion, secret) == nil, nil
+}
+
 // DetermineUpdatedTime retrieves the updated_time value from the single source
 // secret's metadata.
 func (p *CopySourceSecret) DetermineUpdatedTime() (time.Time, error) {
@@ -118,7 +143,7 @@ func (p *CopySourceValues) DetermineUpdatedTime() (time.Time, error) {
 // RetrieveSourceValues queries the single source secret and returns a map of
 // its key-values that can be used to update the target secret.
 func (p *CopySourceSecret) RetrieveSourceValues() (map[string]interface{}, error) {
-	secret, err := p.secret.Source.Read(fmt.Sprintf("%s/data/%s", p.secret.MountPoint, p.secret.Path))
+	secret, err := p.secret.Source.Read(kvDataPath(p.secret.KVVersion, p.secret.MountPoint, p.secret.Path))
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve source secret %q values: %w", p.secret.Name(), err)
 	}
@@ -127,7 +152,12 @@ func (p *CopySourceSecret) RetrieveSourceValues() (map[string]interface{}, error
 		return nil, fmt.Errorf("source secret %q does not exist", p.secret.Name())
 	}
 
-	return secret.Data["data"].(map[string]interface{}), nil
+	data := kvSecretData(p.secret.KVVersion, secret)
+	if data == nil {
+		return nil, fmt.Errorf("source secret %q values are missing", p.secret.Name())
+	}
+
+	return data, nil
 }
 
 // RetrieveSourceValues queries each source secret mapped in the values map of
@@ -137,7 +167,7 @@ func (p *CopySourceValues) RetrieveSourceValues() (map[string]interface{}, error
 	secretValues := make(map[string]interface{})
 
 	for k, v := range p.values {
-		secret, err := v.Source.Read(fmt.Sprintf("%s/data/%s", v.MountPoint, v.Path))
+		secret, err := v.Source.Read(kvDataPath(v.KVVersion, v.MountPoint, v.Path))
 		if err != nil {
 			return nil, fmt.Errorf("failed to retrieve source secret %q values: %w", v.Name(), err)
 		}
@@ -146,11 +176,11 @@ func (p *CopySourceValues) RetrieveSourceValues() (map[string]interface{}, error
 			return nil, fmt.Errorf("source secret %q does not exist", v.Name())
 		}
 
-		if secret.Data == nil || secret.Data["data"] == nil {
+		data := kvSecretData(v.KVVersion, secret)
+		if data == nil {
 			return nil, fmt.Errorf("source secret %q values are missing", v.Name())
 		}
 
-		data := secret.Data["data"].(map[string]interface{})
 		value, found := data[v.Key]
 		if !found {
 			return nil, fmt.Errorf("missing key %s in source secret %q", v.Key, v.Name())
@@ -161,3 +191,19 @@ func (p *CopySourceValues) RetrieveSourceValues() (map[string]interface{}, error
 
 	return secretValues, nil
 }
+
+// sourceValues returns the single CopyValue of the receiver.
+func (p *CopySourceSecret) sourceValues() []*CopyValue {
+	return []*CopyValue{p.secret}
+}
+
+// sourceValues returns every CopyValue mapped in the values map of the
+// receiver.
+func (p *CopySourceValues) sourceValues() []*CopyValue {
+	values := make([]*CopyValue, 0, len(p.values))
+	for _, value := range p.values {
+		values = append(values, value)
+	}
+
+	return values
+}
@@ -0,0 +1,140 @@
+package hvc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// KeyDiff is a structure that describes how a single key of a target secret
+// differs from its source value. Values are only represented by hashes.
+type KeyDiff struct {
+	KeyChange
+
+	// TargetHash is a hash of the key's value in the target secret, or empty if
+	// the key is missing from the target secret.
+	TargetHash string `json:"target-hash,omitempty"`
+
+	// SourceHash is a hash of the key's source value, or empty if the key only
+	// exists in the target secret.
+	SourceHash string `json:"source-hash,omitempty"`
+}
+
+// CopyDiff is a structure that describes how the target secret of a Copy
+// differs from its source values, regardless of when either was updated.
+type CopyDiff struct {
+	// Index is the index of the compared Copy in the Copies field of the
+	// CopyJob.
+	Index int `json:"index"`
+
+	// Name is the canonical name of the target secret.
+	Name string `json:"name"`
+
+	// Exists indicates whether the target secret exists.
+	Exists bool `json:"exists"`
+
+	// Keys lists the keys of the target secret that differ from their source
+	// values, sorted by key. It's empty when the target secret is in sync.
+	Keys []KeyDiff `json:"keys,omitempty"`
+}
+
+// InSync returns true if the target secret exists and none of its keys differ
+// from their source values.
+func (p *CopyDiff) InSync() bool {
+	return p.Exists && len(p.Keys) == 0
+}
+
+// Diff compares the data of the receiver's target secret with its source
+// values using the provided target Vault interface. Unlike Plan, the
+// comparison is made even if the target secret was updated after every source
+// secret, so that changes made directly to the target secret are detected.
+func (p *Copy) Diff(target Vault) (*CopyDiff, error) {
+	target, err := withNamespace(target, p.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := target.Read(kvDataPath(p.KVVersion, p.MountPoint, p.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve target secret %q values: %w", p.Name(), err)
+	}
+
+	sourceData, err := p.SourceSecret.RetrieveSourceValues()
+	if err != nil {
+		return nil, err
+	}
+
+	targetData := kvSecretData(p.KVVersion, secret)
+
+	diff := &CopyDiff{
+		Name:   p.Name(),
+		Exists: targetData != nil,
+		Keys:   []KeyDiff{},
+	}
+
+	desiredData, err := p.desiredData(target, targetData, sourceData)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range diffKeys(targetData, desiredData) {
+		keyDiff := KeyDiff{KeyChange: change}
+
+		if value, found := targetData[change.Key]; found {
+			keyDiff.TargetHash = hashValue(value)
+		}
+
+		if value, found := desiredData[change.Key]; found {
+			keyDiff.SourceHash = hashValue(value)
+		}
+
+		diff.Keys = append(diff.Keys, keyDiff)
+	}
+
+	return diff, nil
+}
+
+// Diff compares the target secret of every Copy of the receiver with its
+// source values. The returned slice holds one CopyDiff per Copy, in the same
+// order, with nil entries for the copies that failed.
+func (p *CopyJob) Diff() ([]*CopyDiff, []error) {
+	diffs := make([]*CopyDiff, len(p.Copies))
+	errorSlice := make([]error, len(p.Copies))
+
+	waitGroup := sync.WaitGroup{}
+
+	for i, copy := range p.Copies {
+		waitGroup.Add(1)
+		go func(copy *Copy, i int) {
+			diff, err := copy.Diff(p.Target)
+			if err != nil {
+				errorSlice[i] = fmt.Errorf("failed to diff copy %d: %w", i, err)
+			} else {
+				diff.Index = i
+			}
+
+			diffs[i] = diff
+			waitGroup.Done()
+		}(copy, i)
+	}
+
+	waitGroup.Wait()
+
+	return diffs, compactErrors(errorSlice)
+}
+
+// hashValue returns an abbreviated SHA-256 hash of the JSON encoding of the
+// provided secret value, which is enough to tell values apart without
+// revealing them.
+func hashValue(value interface{}) string {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		valueBytes = []byte(fmt.Sprint(value))
+	}
+
+	hash := sha256.Sum256(valueBytes)
+
+	return hex.EncodeToString(hash[:])[:12]
+}
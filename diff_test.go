@@ -0,0 +1,77 @@
+package hvc
+
+import (
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyDiff(t *testing.T) {
+	for _, testcase := range []struct {
+		targetResponse FakeVaultResponse
+		expectedExists bool
+		expectedKeys   []KeyDiff
+	}{
+		// Target secret doesn't exist
+		{
+			targetResponse: FakeVaultResponse{secret: nil},
+			expectedExists: false,
+			expectedKeys: []KeyDiff{
+				{KeyChange: KeyChange{Key: "k1", Type: KeyAdded}, SourceHash: hashValue("v1")},
+			},
+		},
+		// Target secret was edited after the last copy
+		{
+			targetResponse: FakeVaultResponse{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "edited", "extra": "v"}}}},
+			expectedExists: true,
+			expectedKeys: []KeyDiff{
+				{KeyChange: KeyChange{Key: "extra", Type: KeyRemoved}, TargetHash: hashValue("v")},
+				{KeyChange: KeyChange{Key: "k1", Type: KeyChanged}, TargetHash: hashValue("edited"), SourceHash: hashValue("v1")},
+			},
+		},
+		// Target secret is in sync
+		{
+			targetResponse: FakeVaultResponse{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+			expectedExists: true,
+			expectedKeys:   []KeyDiff{},
+		},
+	} {
+		copy := &Copy{
+			MountPoint: "kv",
+			Path:       "p1",
+			SourceSecret: &CopySourceSecret{
+				secret: &CopyValue{
+					Source: &FakeVault{
+						name: "s1",
+						readResponses: []FakeVaultResponse{
+							{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+						},
+					},
+					MountPoint: "kv",
+					Path:       "p1",
+				},
+			},
+		}
+
+		target := &FakeVault{
+			name:          "_target",
+			readResponses: []FakeVaultResponse{testcase.targetResponse},
+		}
+
+		diff, err := copy.Diff(target)
+		assert.NoError(t, err)
+		assert.Equal(t, "kv/p1", diff.Name)
+		assert.Equal(t, testcase.expectedExists, diff.Exists)
+		assert.Equal(t, testcase.expectedKeys, diff.Keys)
+		assert.Equal(t, []string{"kv/data/p1"}, target.reads)
+		assert.Empty(t, target.writes)
+	}
+}
+
+func TestHashValue(t *testing.T) {
+	assert.Len(t, hashValue("secret"), 12)
+	assert.Equal(t, hashValue("secret"), hashValue("secret"))
+	assert.NotEqual(t, hashValue("secret"), hashValue("other"))
+	assert.NotContains(t, hashValue("secret"), "secret")
+}
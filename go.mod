@@ -4,7 +4,9 @@ go 1.16
 
 require (
 	github.com/gruntwork-io/terratest v0.40.7
+	github.com/hashicorp/hcl v1.0.0
 	github.com/hashicorp/vault/api v1.3.1
+	github.com/hashicorp/vault/api/auth/approle v0.1.1
 	github.com/hashicorp/vault/api/auth/kubernetes v0.1.0
 	github.com/spf13/cobra v1.4.0
 	github.com/stretchr/testify v1.7.0
@@ -12,4 +14,5 @@ require (
 	k8s.io/apimachinery v0.24.0
 	k8s.io/cli-runtime v0.24.0
 	k8s.io/client-go v0.24.0
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -0,0 +1,226 @@
+package hvc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// ErrTargetConflict is the error wrapped when a target secret is changed by
+// another writer between the time its need to be updated is determined and the
+// time it's written.
+var ErrTargetConflict = errors.New("target secret was changed by another writer since it was checked")
+
+// mountCache is a structure that caches the KV secrets engines mounted in
+// each Vault server along with their version, so that each mount is only
+// inspected once for the whole copy job. Vault servers are identified by their
+// name.
+type mountCache struct {
+	mutex  sync.Mutex
+	mounts map[string]map[string]int
+}
+
+// newMountCache creates an empty mountCache structure.
+func newMountCache() *mountCache {
+	return &mountCache{
+		mounts: make(map[string]map[string]int),
+	}
+}
+
+// version returns the version of the KV secrets engine mounted at the provided
+// mount point in the provided Vault server. The version is retrieved from the
+// sys/internal/ui/mounts endpoint the first time a mount point is requested.
+func (p *mountCache) version(vault Vault, mountPoint string) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if version, found := p.mounts[vault.Name()][mountPoint]; found {
+		return version, nil
+	}
+
+	secret, err := vault.Read(fmt.Sprintf("sys/internal/ui/mounts/%s", mountPoint))
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve details of mount %s in %s: %w", mountPoint, vault.Name(), err)
+	}
+
+	version, err := parseKVVersion(secret)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine KV version of mount %s in %s: %w", mountPoint, vault.Name(), err)
+	}
+
+	p.store(vault, mountPoint, version)
+
+	return version, nil
+}
+
+// resolve splits the provided full logical path into the mount point of the
+// KV secrets engine that contains it and the path of the secret within that
+// secrets engine, and also returns the version of that secrets engine. The
+// function returns false if no mount in the provided Vault server contains the
+// full logical path. Vault servers answer with a 403 response rather than a
+// 400 or 404 response when no mount matches, so that the endpoint can't be
+// used to discover mounts.
+func (p *mountCache) resolve(vault Vault, fullPath string) (string, string, int, bool, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	mountPoint := ""
+	for cachedMountPoint := range p.mounts[vault.Name()] {
+		if strings.HasPrefix(fullPath, cachedMountPoint+"/") && len(cachedMountPoint) > len(mountPoint) {
+			mountPoint = cachedMountPoint
+		}
+	}
+
+	if mountPoint == "" {
+		secret, err := vault.Read(fmt.Sprintf("sys/internal/ui/mounts/%s", fullPath))
+		if err != nil {
+			var responseError *vaultapi.ResponseError
+			if errors.As(err, &responseError) && (responseError.StatusCode == http.StatusBadRequest || responseError.StatusCode == http.StatusForbidden || responseError.StatusCode == http.StatusNotFound) {
+				return "", "", 0, false, nil
+			}
+
+			return "", "", 0, false, fmt.Errorf("failed to retrieve the mount of path %s in %s: %w", fullPath, vault.Name(), err)
+		}
+
+		if secret == nil || secret.Data == nil {
+			return "", "", 0, false, nil
+		}
+
+		mountPath, _ := secret.Data["path"].(string)
+		mountPoint = strings.TrimSuffix(mountPath, "/")
+		if mountPoint == "" || !strings.HasPrefix(fullPath, mountPoint+"/") {
+			return "", "", 0, false, nil
+		}
+
+		version, err := parseKVVersion(secret)
+		if err != nil {
+			return "", "", 0, false, fmt.Errorf("failed to determine KV version of mount %s in %s: %w", mountPoint, vault.Name(), err)
+		}
+
+		p.store(vault, mountPoint, version)
+	}
+
+	return mountPoint, strings.TrimPrefix(fullPath, mountPoint+"/"), p.mounts[vault.Name()][mountPoint], true, nil
+}
+
+// store records the version of the KV secrets engine mounted at the provided
+// mount point in the provided Vault server. The caller must hold the
+// receiver's mutex.
+func (p *mountCache) store(vault Vault, mountPoint string, version int) {
+	if p.mounts[vault.Name()] == nil {
+		p.mounts[vault.Name()] = make(map[string]int)
+	}
+
+	p.mounts[vault.Name()][mountPoint] = version
+}
+
+// parseKVVersion extracts the KV secrets engine version from the provided
+// response of the sys/internal/ui/mounts endpoint. A missing response, which
+// is returned by Vault servers that predate that endpoint, indicates version 1.
+func parseKVVersion(secret *vaultapi.Secret) (int, error) {
+	if secret == nil || secret.Data == nil {
+		return 1, nil
+	}
+
+	if mountType, _ := secret.Data["type"].(string); mountType != "" && mountType != "kv" && mountType != "generic" {
+		return 0, fmt.Errorf("mount is a %s secrets engine rather than a KV secrets engine", mountType)
+	}
+
+	options, _ := secret.Data["options"].(map[string]interface{})
+	if version, _ := options["version"].(string); version == "2" {
+		return 2, nil
+	}
+
+	return 1, nil
+}
+
+// kvDataPath returns the API path used to read and write the data of a secret
+// in a KV secrets engine of the provided version.
+func kvDataPath(version int, mountPoint, path string) string {
+	if version == 1 {
+		return fmt.Sprintf("%s/%s", mountPoint, path)
+	}
+
+	return fmt.Sprintf("%s/data/%s", mountPoint, path)
+}
+
+// kvListPath returns the API path used to list the secrets under the provided
+// path in a KV secrets engine of the provided version.
+func kvListPath(version int, mountPoint, path string) string {
+	if version == 1 {
+		return fmt.Sprintf("%s/%s", mountPoint, path)
+	}
+
+	return fmt.Sprintf("%s/metadata/%s", mountPoint, path)
+}
+
+// kvSecretData extracts the key-value pairs from a secret read from a KV
+// secrets engine of the provided version. It returns nil if the secret
+// contains no data, such as when the latest version of a KV version 2 secret
+// is deleted.
+func kvSecretData(version int, secret *vaultapi.Secret) map[string]interface{} {
+	if secret == nil || secret.Data == nil {
+		return nil
+	}
+
+	if version == 1 {
+		return secret.Data
+	}
+
+	data, _ := secret.Data["data"].(map[string]interface{})
+
+	return data
+}
+
+// kvWriteData wraps the provided key-value pairs in the request body expected
+// by a KV secrets engine of the provided version.
+func kvWriteData(version int, data map[string]interface{}) map[string]interface{} {
+	if version == 1 {
+		return data
+	}
+
+	return map[string]interface{}{"data": data}
+}
+
+// kvDataVersion extracts the version of a secret read from a KV version 2
+// secrets engine, which is 0 when the secret doesn't exist.
+func kvDataVersion(secret *vaultapi.Secret) (int, error) {
+	if secret == nil || secret.Data == nil {
+		return 0, nil
+	}
+
+	metadata, _ := secret.Data["metadata"].(map[string]interface{})
+	if metadata["version"] == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(fmt.Sprint(metadata["version"]))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse version value %v: %w", metadata["version"], err)
+	}
+
+	return version, nil
+}
+
+// isCheckAndSetMismatch determines if the provided error is returned by a Vault
+// server when a secret is written with a check-and-set version that isn't its
+// current version.
+func isCheckAndSetMismatch(err error) bool {
+	var responseError *vaultapi.ResponseError
+	if !errors.As(err, &responseError) || responseError.StatusCode != http.StatusBadRequest {
+		return false
+	}
+
+	for _, message := range responseError.Errors {
+		if strings.Contains(message, "check-and-set parameter did not match the current version") {
+			return true
+		}
+	}
+
+	return false
+}
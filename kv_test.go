@@ -0,0 +1,151 @@
+package hvc
+
+import (
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKVVersion(t *testing.T) {
+	for _, testcase := range []struct {
+		secret          *vault.Secret
+		errorAssert     func(assert.TestingT, error, ...interface{}) bool
+		expectedVersion int
+	}{
+		// KV version 2
+		{
+			secret: &vault.Secret{
+				Data: map[string]interface{}{
+					"type":    "kv",
+					"options": map[string]interface{}{"version": "2"},
+				},
+			},
+			errorAssert:     assert.NoError,
+			expectedVersion: 2,
+		},
+		// KV version 1
+		{
+			secret: &vault.Secret{
+				Data: map[string]interface{}{
+					"type":    "kv",
+					"options": map[string]interface{}{"version": "1"},
+				},
+			},
+			errorAssert:     assert.NoError,
+			expectedVersion: 1,
+		},
+		// KV without options
+		{
+			secret: &vault.Secret{
+				Data: map[string]interface{}{
+					"type": "kv",
+				},
+			},
+			errorAssert:     assert.NoError,
+			expectedVersion: 1,
+		},
+		// Vault server without the endpoint
+		{
+			secret:          nil,
+			errorAssert:     assert.NoError,
+			expectedVersion: 1,
+		},
+		// Not a KV secrets engine
+		{
+			secret: &vault.Secret{
+				Data: map[string]interface{}{
+					"type": "pki",
+				},
+			},
+			errorAssert: assert.Error,
+		},
+	} {
+		version, err := parseKVVersion(testcase.secret)
+		testcase.errorAssert(t, err)
+		assert.Equal(t, testcase.expectedVersion, version)
+	}
+}
+
+func TestMountCacheReadsMountOnce(t *testing.T) {
+	fakeVault := &FakeVault{
+		name: "fake",
+		readResponses: []FakeVaultResponse{
+			{
+				secret: &vault.Secret{
+					Data: map[string]interface{}{
+						"type": "kv",
+					},
+				},
+			},
+		},
+	}
+
+	cache := newMountCache()
+	for i := 0; i < 2; i++ {
+		version, err := cache.version(fakeVault, "secret")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, version)
+	}
+
+	assert.Equal(t, []string{"sys/internal/ui/mounts/secret"}, fakeVault.reads)
+}
+
+func TestKVPaths(t *testing.T) {
+	assert.Equal(t, "secret/p1", kvDataPath(1, "secret", "p1"))
+	assert.Equal(t, "kv/data/p1", kvDataPath(2, "kv", "p1"))
+	assert.Equal(t, map[string]interface{}{"k1": "v1"}, kvWriteData(1, map[string]interface{}{"k1": "v1"}))
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}, kvWriteData(2, map[string]interface{}{"k1": "v1"}))
+}
+
+func TestMountCacheResolve(t *testing.T) {
+	fakeVault := &FakeVault{
+		name: "fake",
+		readResponses: []FakeVaultResponse{
+			{
+				secret: &vault.Secret{
+					Data: map[string]interface{}{
+						"path":    "secret/",
+						"type":    "kv",
+						"options": map[string]interface{}{"version": "2"},
+					},
+				},
+			},
+			// No mount contains the path
+			{
+				err: &vault.ResponseError{StatusCode: 400},
+			},
+			// No mount contains the path, as reported by recent Vault servers
+			{
+				err: &vault.ResponseError{StatusCode: 403, Errors: []string{"preflight capability check returned 403, please ensure client's policies grant access to path \"team/app/\""}},
+			},
+		},
+	}
+
+	cache := newMountCache()
+
+	mountPoint, path, version, found, err := cache.resolve(fakeVault, "secret/team/app")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "secret", mountPoint)
+	assert.Equal(t, "team/app", path)
+	assert.Equal(t, 2, version)
+
+	// The cached mount is used without reading the endpoint again.
+	mountPoint, path, version, found, err = cache.resolve(fakeVault, "secret/team/db")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "secret", mountPoint)
+	assert.Equal(t, "team/db", path)
+	assert.Equal(t, 2, version)
+
+	_, _, _, found, err = cache.resolve(fakeVault, "my-service/my-secret")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, _, found, err = cache.resolve(fakeVault, "team/app")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.Equal(t, []string{"sys/internal/ui/mounts/secret/team/app", "sys/internal/ui/mounts/my-service/my-secret", "sys/internal/ui/mounts/team/app"}, fakeVault.reads)
+}
@@ -0,0 +1,276 @@
+package hvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	approleauth "github.com/hashicorp/vault/api/auth/approle"
+	k8sauth "github.com/hashicorp/vault/api/auth/kubernetes"
+	"github.com/marcboudreau/hvc/spec"
+)
+
+// newAuthMethod creates the vault.AuthMethod that corresponds to the login
+// strategy specified in the provided spec.VaultLogin object.
+func newAuthMethod(spec *spec.VaultLogin) (vault.AuthMethod, error) {
+	switch {
+	case spec.Kubernetes != nil:
+		return newKubernetesAuthMethod(spec.Kubernetes)
+	case spec.AppRole != nil:
+		return newAppRoleAuthMethod(spec.AppRole)
+	case spec.JWT != nil:
+		return newJWTAuthMethod(spec.JWT)
+	case spec.Cert != nil:
+		return newCertAuthMethod(spec.Cert), nil
+	case spec.Userpass != nil:
+		return newPasswordAuthMethod(spec.Userpass, "Userpass", "userpass")
+	case spec.LDAP != nil:
+		return newPasswordAuthMethod(spec.LDAP, "LDAP", "ldap")
+	}
+
+	return nil, errors.New("no login strategy specified")
+}
+
+// newKubernetesAuthMethod creates a vault.AuthMethod that uses the Kubernetes
+// authentication method.
+func newKubernetesAuthMethod(spec *spec.VaultKubernetesLogin) (vault.AuthMethod, error) {
+	kubernetesMountPoint := "kubernetes"
+	if spec.MountPoint != "" {
+		kubernetesMountPoint = spec.MountPoint
+	}
+
+	jwtPath := "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	if spec.JWTPath != "" {
+		jwtPath = spec.JWTPath
+	}
+
+	auth, err := k8sauth.NewKubernetesAuth(
+		spec.Role,
+		k8sauth.WithServiceAccountTokenPath(jwtPath),
+		k8sauth.WithMountPath(kubernetesMountPoint),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Kubernetes authentication method: %w", err)
+	}
+
+	return auth, nil
+}
+
+// newAppRoleAuthMethod creates a vault.AuthMethod that uses the AppRole
+// authentication method.
+func newAppRoleAuthMethod(spec *spec.VaultAppRoleLogin) (vault.AuthMethod, error) {
+	appRoleMountPoint := "approle"
+	if spec.MountPoint != "" {
+		appRoleMountPoint = spec.MountPoint
+	}
+
+	secretID := &approleauth.SecretID{
+		FromString: spec.SecretID,
+		FromFile:   spec.SecretIDFile,
+	}
+
+	options := []approleauth.LoginOption{
+		approleauth.WithMountPath(appRoleMountPoint),
+	}
+
+	if spec.Wrapped {
+		options = append(options, approleauth.WithWrappingToken())
+	}
+
+	auth, err := approleauth.NewAppRoleAuth(spec.RoleID, secretID, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize AppRole authentication method: %w", err)
+	}
+
+	return auth, nil
+}
+
+// jwtAuth implements the vault.AuthMethod interface for the JWT/OIDC
+// authentication method. The signed JWT is loaded every time a login
+// operation is performed, so that a rotated JWT is picked up.
+type jwtAuth struct {
+	mountPoint string
+	role       string
+	jwtPath    string
+	jwtEnv     string
+}
+
+// newJWTAuthMethod creates a vault.AuthMethod that uses the JWT/OIDC
+// authentication method.
+func newJWTAuthMethod(spec *spec.VaultJWTLogin) (vault.AuthMethod, error) {
+	if spec.Role == "" {
+		return nil, errors.New("failed to initialize JWT authentication method: no role provided")
+	}
+
+	if (spec.JWTPath == "") == (spec.JWTEnv == "") {
+		return nil, errors.New("failed to initialize JWT authentication method: exactly one of jwt-path and jwt-env must be provided")
+	}
+
+	jwtMountPoint := "jwt"
+	if spec.MountPoint != "" {
+		jwtMountPoint = spec.MountPoint
+	}
+
+	return &jwtAuth{
+		mountPoint: jwtMountPoint,
+		role:       spec.Role,
+		jwtPath:    spec.JWTPath,
+		jwtEnv:     spec.JWTEnv,
+	}, nil
+}
+
+// Login loads the signed JWT and uses it to perform a login operation with the
+// JWT authentication method.
+func (p *jwtAuth) Login(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+	var jwt string
+	if p.jwtPath != "" {
+		jwtBytes, err := ioutil.ReadFile(p.jwtPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT from file %s: %w", p.jwtPath, err)
+		}
+
+		jwt = strings.TrimSpace(string(jwtBytes))
+	} else {
+		jwt = os.Getenv(p.jwtEnv)
+		if jwt == "" {
+			return nil, fmt.Errorf("environment variable %s does not contain a JWT", p.jwtEnv)
+		}
+	}
+
+	return client.Logical().Write(fmt.Sprintf("auth/%s/login", p.mountPoint), map[string]interface{}{
+		"role": p.role,
+		"jwt":  jwt,
+	})
+}
+
+// certAuth implements the vault.AuthMethod interface for the TLS Certificates
+// authentication method. The client certificate is presented by the TLS
+// configuration of the API Client.
+type certAuth struct {
+	mountPoint string
+	name       string
+}
+
+// newCertAuthMethod creates a vault.AuthMethod that uses the TLS Certificates
+// authentication method.
+func newCertAuthMethod(spec *spec.VaultCertLogin) vault.AuthMethod {
+	certMountPoint := "cert"
+	if spec.MountPoint != "" {
+		certMountPoint = spec.MountPoint
+	}
+
+	return &certAuth{
+		mountPoint: certMountPoint,
+		name:       spec.Name,
+	}
+}
+
+// Login performs a login operation with the TLS Certificates authentication
+// method.
+func (p *certAuth) Login(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+	data := map[string]interface{}{}
+	if p.name != "" {
+		data["name"] = p.name
+	}
+
+	return client.Logical().Write(fmt.Sprintf("auth/%s/login", p.mountPoint), data)
+}
+
+// passwordAuth implements the vault.AuthMethod interface for authentication
+// methods that accept a username and password. The password is loaded every
+// time a login operation is performed and is never included in the returned
+// errors.
+type passwordAuth struct {
+	method       string
+	mountPoint   string
+	username     string
+	passwordFile string
+	passwordEnv  string
+}
+
+// newPasswordAuthMethod creates a vault.AuthMethod that uses the username and
+// password authentication method identified by the provided method name and
+// default mount point.
+func newPasswordAuthMethod(spec *spec.VaultPasswordLogin, method, defaultMountPoint string) (vault.AuthMethod, error) {
+	if spec.Username == "" {
+		return nil, fmt.Errorf("failed to initialize %s authentication method: no username provided", method)
+	}
+
+	if (spec.PasswordFile == "") == (spec.PasswordEnv == "") {
+		return nil, fmt.Errorf("failed to initialize %s authentication method: exactly one of password-file and password-env must be provided", method)
+	}
+
+	mountPoint := defaultMountPoint
+	if spec.MountPoint != "" {
+		mountPoint = spec.MountPoint
+	}
+
+	return &passwordAuth{
+		method:       method,
+		mountPoint:   mountPoint,
+		username:     spec.Username,
+		passwordFile: spec.PasswordFile,
+		passwordEnv:  spec.PasswordEnv,
+	}, nil
+}
+
+// Login loads the password and uses it to perform a login operation as the
+// configured username.
+func (p *passwordAuth) Login(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+	var password string
+	if p.passwordFile != "" {
+		passwordBytes, err := ioutil.ReadFile(p.passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s password from file %s: %w", p.method, p.passwordFile, err)
+		}
+
+		password = strings.TrimRight(string(passwordBytes), "\r\n")
+	} else {
+		password = os.Getenv(p.passwordEnv)
+		if password == "" {
+			return nil, fmt.Errorf("environment variable %s does not contain a %s password", p.passwordEnv, p.method)
+		}
+	}
+
+	secret, err := client.Logical().Write(fmt.Sprintf("auth/%s/login/%s", p.mountPoint, p.username), map[string]interface{}{
+		"password": password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to log in as %s with %s authentication method: %w", p.username, p.method, redactError(err, password))
+	}
+
+	return secret, nil
+}
+
+// redactError returns an error whose message has every occurrence of the
+// provided value replaced, so that sensitive values are never reported. The
+// returned error still wraps the provided error.
+func redactError(err error, value string) error {
+	if value == "" || !strings.Contains(err.Error(), value) {
+		return err
+	}
+
+	return &redactedError{err: err, value: value}
+}
+
+// redactedError is an error that wraps another error whose message contains a
+// sensitive value, and that reports that message with the value replaced.
+type redactedError struct {
+	err   error
+	value string
+}
+
+// Error returns the message of the wrapped error, with every occurrence of the
+// sensitive value replaced.
+func (p *redactedError) Error() string {
+	return strings.ReplaceAll(p.err.Error(), p.value, "<redacted>")
+}
+
+// Unwrap returns the wrapped error.
+func (p *redactedError) Unwrap() error {
+	return p.err
+}
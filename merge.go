@@ -0,0 +1,285 @@
+package hvc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// copiedKeysMetadataKey is the key of the custom metadata of a target secret
+// that records the keys copied by the last merge that removes unmapped keys.
+const copiedKeysMetadataKey = "hvc-copied-keys"
+
+// desiredData returns the key-value pairs that the target secret holds once
+// the provided source values are copied to it, given its provided current
+// key-value pairs. Unless the receiver merges, those are the source values.
+func (p *Copy) desiredData(target Vault, targetData, sourceData map[string]interface{}) (map[string]interface{}, error) {
+	if !p.Merge {
+		return sourceData, nil
+	}
+
+	unmappedKeys, err := p.unmappedKeys(target, sourceData)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeData(targetData, sourceData, unmappedKeys), nil
+}
+
+// mergeTargetSecret merges the provided source values into the target secret
+// referenced in the receiver using the provided target Vault interface. In a
+// KV version 2 secrets engine, the target secret is patched, unless the
+// target secret doesn't exist or the Vault server doesn't support patching, in
+// which case it's read and the merged values are written. Either way, the
+// provided version is used to check-and-set like UpdateTargetSecret.
+func (p *Copy) mergeTargetSecret(target Vault, sourceData map[string]interface{}, version int) error {
+	copiedKeys, err := p.copiedKeys(target)
+	if err != nil {
+		return err
+	}
+
+	unmappedKeys := selectUnmappedKeys(copiedKeys, sourceData)
+
+	// The source keys are recorded along with the previously copied keys
+	// before the target secret is written, so that a failure to record the
+	// copied keys once it's written never prevents a later merge from
+	// removing a key.
+	if pending := union(copiedKeys, sourceData); len(pending) > len(copiedKeys) {
+		if err := p.recordCopiedKeys(target, pending); err != nil {
+			return err
+		}
+	}
+
+	if p.KVVersion != 1 {
+		patch := make(map[string]interface{})
+		for key, value := range sourceData {
+			patch[key] = value
+		}
+
+		// A null value removes the key from the target secret.
+		for _, key := range unmappedKeys {
+			patch[key] = nil
+		}
+
+		_, err := target.Patch(kvDataPath(p.KVVersion, p.MountPoint, p.Path), p.checkAndSet(map[string]interface{}{"data": patch}, version))
+		if err == nil {
+			return p.recordCopiedKeys(target, union(nil, sourceData))
+		}
+
+		if isCheckAndSetMismatch(err) {
+			return fmt.Errorf("failed to patch target secret %q: %w", p.Name(), ErrTargetConflict)
+		}
+
+		if !isPatchUnsupported(err) {
+			return fmt.Errorf("failed to patch target secret %q: %w", p.Name(), err)
+		}
+	}
+
+	secret, err := target.Read(kvDataPath(p.KVVersion, p.MountPoint, p.Path))
+	if err != nil {
+		return fmt.Errorf("failed to retrieve target secret %q values: %w", p.Name(), err)
+	}
+
+	data := kvWriteData(p.KVVersion, mergeData(kvSecretData(p.KVVersion, secret), sourceData, unmappedKeys))
+	if _, err := target.Write(kvDataPath(p.KVVersion, p.MountPoint, p.Path), p.checkAndSet(data, version)); err != nil {
+		return p.writeError(err)
+	}
+
+	return p.recordCopiedKeys(target, union(nil, sourceData))
+}
+
+// unmappedKeys returns the keys that a previous merge recorded as copied to the
+// target secret, but that aren't part of the provided source values anymore.
+// Nothing is returned unless the receiver removes unmapped keys.
+func (p *Copy) unmappedKeys(target Vault, sourceData map[string]interface{}) ([]string, error) {
+	copiedKeys, err := p.copiedKeys(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectUnmappedKeys(copiedKeys, sourceData), nil
+}
+
+// copiedKeys returns the keys that a previous merge recorded as copied to the
+// target secret. Nothing is returned unless the receiver removes unmapped
+// keys.
+func (p *Copy) copiedKeys(target Vault) ([]string, error) {
+	if !p.RemoveUnmapped {
+		return nil, nil
+	}
+
+	customMetadata, err := p.customMetadata(target)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, found := customMetadata[copiedKeysMetadataKey].(string)
+	if !found {
+		return nil, nil
+	}
+
+	copiedKeys := []string{}
+	if err := json.Unmarshal([]byte(recorded), &copiedKeys); err != nil {
+		return nil, fmt.Errorf("failed to parse the copied keys recorded in target secret %q metadata: %w", p.Name(), err)
+	}
+
+	return copiedKeys, nil
+}
+
+// selectUnmappedKeys returns the provided copied keys that aren't part of the
+// provided source values.
+func selectUnmappedKeys(copiedKeys []string, sourceData map[string]interface{}) []string {
+	unmappedKeys := []string{}
+	for _, key := range copiedKeys {
+		if _, found := sourceData[key]; !found {
+			unmappedKeys = append(unmappedKeys, key)
+		}
+	}
+
+	return unmappedKeys
+}
+
+// union returns the provided keys along with the keys of the provided source
+// values, sorted and without duplicates.
+func union(keys []string, sourceData map[string]interface{}) []string {
+	found := make(map[string]bool)
+	for _, key := range keys {
+		found[key] = true
+	}
+
+	for key := range sourceData {
+		found[key] = true
+	}
+
+	union := make([]string, 0, len(found))
+	for key := range found {
+		union = append(union, key)
+	}
+
+	sort.Strings(union)
+
+	return union
+}
+
+// recordCopiedKeys records the provided keys in the custom metadata of the
+// target secret, so that a later merge can remove the keys that are no longer
+// copied. The custom metadata is patched so that only the recorded keys are
+// changed, unless the Vault server doesn't support patching, in which case
+// it's read and written back with the recorded keys. Nothing is recorded
+// unless the receiver removes unmapped keys.
+func (p *Copy) recordCopiedKeys(target Vault, keys []string) error {
+	if !p.RemoveUnmapped {
+		return nil
+	}
+
+	keysBytes, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	metadataPath := fmt.Sprintf("%s/metadata/%s", p.MountPoint, p.Path)
+
+	_, err = target.Patch(metadataPath, map[string]interface{}{
+		"custom_metadata": map[string]interface{}{copiedKeysMetadataKey: string(keysBytes)},
+	})
+	if err == nil {
+		return nil
+	}
+
+	if !isPatchUnsupported(err) {
+		return fmt.Errorf("failed to record the copied keys in target secret %q metadata: %w", p.Name(), err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		customMetadata, err := p.customMetadata(target)
+		if err != nil {
+			return err
+		}
+
+		updated := map[string]interface{}{copiedKeysMetadataKey: string(keysBytes)}
+		for key, value := range customMetadata {
+			if key != copiedKeysMetadataKey {
+				updated[key] = value
+			}
+		}
+
+		// The custom metadata is read again right before it's written, so
+		// that the changes made by other writers in the meantime aren't
+		// overwritten.
+		current, err := p.customMetadata(target)
+		if err != nil {
+			return err
+		}
+
+		if !reflect.DeepEqual(current, customMetadata) {
+			if attempt < p.ConflictRetries {
+				continue
+			}
+
+			return fmt.Errorf("failed to record the copied keys in target secret %q metadata: %w", p.Name(), ErrTargetConflict)
+		}
+
+		if _, err := target.Write(metadataPath, map[string]interface{}{"custom_metadata": updated}); err != nil {
+			return fmt.Errorf("failed to record the copied keys in target secret %q metadata: %w", p.Name(), err)
+		}
+
+		return nil
+	}
+}
+
+// customMetadata retrieves the custom metadata of the target secret, which
+// only exists in a KV version 2 secrets engine.
+func (p *Copy) customMetadata(target Vault) (map[string]interface{}, error) {
+	if p.KVVersion == 1 {
+		return nil, fmt.Errorf("removing the unmapped keys of target secret %q requires a KV version 2 secrets engine", p.Name())
+	}
+
+	secret, err := target.Read(fmt.Sprintf("%s/metadata/%s", p.MountPoint, p.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve target secret %q metadata: %w", p.Name(), err)
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	customMetadata, _ := secret.Data["custom_metadata"].(map[string]interface{})
+
+	return customMetadata, nil
+}
+
+// mergeData returns the provided target key-value pairs without the provided
+// unmapped keys, updated with the provided source key-value pairs.
+func mergeData(targetData, sourceData map[string]interface{}, unmappedKeys []string) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for key, value := range targetData {
+		merged[key] = value
+	}
+
+	for _, key := range unmappedKeys {
+		delete(merged, key)
+	}
+
+	for key, value := range sourceData {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// isPatchUnsupported determines if the provided error is returned by a Vault
+// server when a secret can't be patched, either because the secret doesn't
+// exist or because the server predates the PATCH operation.
+func isPatchUnsupported(err error) bool {
+	var responseError *vaultapi.ResponseError
+	if !errors.As(err, &responseError) {
+		return false
+	}
+
+	return responseError.StatusCode == http.StatusNotFound || responseError.StatusCode == http.StatusMethodNotAllowed
+}
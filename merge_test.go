@@ -0,0 +1,314 @@
+package hvc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeTargetSecret(t *testing.T) {
+	for _, testcase := range []struct {
+		kvVersion       int
+		version         int
+		readResponses   []FakeVaultResponse
+		patchResponses  []FakeVaultResponse
+		expectedPatches []FakeVaultWrite
+		expectedWrites  []FakeVaultWrite
+		expectedError   string
+	}{
+		// Patch
+		{
+			kvVersion:       2,
+			patchResponses:  []FakeVaultResponse{{secret: &vault.Secret{}}},
+			expectedPatches: []FakeVaultWrite{{path: "kv/data/p1", data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}, "options": map[string]interface{}{"cas": 0}}}},
+		},
+		// Read-modify-write when the target secret doesn't exist
+		{
+			kvVersion:       2,
+			readResponses:   []FakeVaultResponse{{secret: nil}},
+			patchResponses:  []FakeVaultResponse{{err: &vault.ResponseError{StatusCode: 404}}},
+			expectedPatches: []FakeVaultWrite{{path: "kv/data/p1", data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}, "options": map[string]interface{}{"cas": 0}}}},
+			expectedWrites: []FakeVaultWrite{{path: "kv/data/p1", data: map[string]interface{}{
+				"data":    map[string]interface{}{"k1": "v1"},
+				"options": map[string]interface{}{"cas": 0},
+			}}},
+		},
+		// Read-modify-write when the Vault server can't patch
+		{
+			kvVersion: 2,
+			version:   4,
+			readResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{
+					"data":     map[string]interface{}{"k1": "v0", "k2": "v2"},
+					"metadata": map[string]interface{}{"version": json.Number("4")},
+				}}},
+			},
+			patchResponses:  []FakeVaultResponse{{err: &vault.ResponseError{StatusCode: 405}}},
+			expectedPatches: []FakeVaultWrite{{path: "kv/data/p1", data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}, "options": map[string]interface{}{"cas": 4}}}},
+			expectedWrites: []FakeVaultWrite{{path: "kv/data/p1", data: map[string]interface{}{
+				"data":    map[string]interface{}{"k1": "v1", "k2": "v2"},
+				"options": map[string]interface{}{"cas": 4},
+			}}},
+		},
+		// Read-modify-write in a KV version 1 secrets engine
+		{
+			kvVersion: 1,
+			readResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v0", "k2": "v2"}}},
+			},
+			expectedWrites: []FakeVaultWrite{{path: "kv/p1", data: map[string]interface{}{"k1": "v1", "k2": "v2"}}},
+		},
+		// Patch denied
+		{
+			kvVersion:       2,
+			patchResponses:  []FakeVaultResponse{{err: errors.New("permission denied")}},
+			expectedPatches: []FakeVaultWrite{{path: "kv/data/p1", data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}, "options": map[string]interface{}{"cas": 0}}}},
+			expectedError:   `failed to patch target secret "kv/p1": permission denied`,
+		},
+	} {
+		target := &FakeVault{
+			name:           "target",
+			readResponses:  testcase.readResponses,
+			patchResponses: testcase.patchResponses,
+			writeResponses: []FakeVaultResponse{{secret: &vault.Secret{}}},
+		}
+
+		copy := &Copy{MountPoint: "kv", Path: "p1", KVVersion: testcase.kvVersion, Merge: true}
+
+		err := copy.mergeTargetSecret(target, map[string]interface{}{"k1": "v1"}, testcase.version)
+		if testcase.expectedError != "" {
+			assert.EqualError(t, err, testcase.expectedError)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, testcase.expectedPatches, target.patches)
+		assert.Equal(t, testcase.expectedWrites, target.writes)
+	}
+}
+
+func TestMergeTargetSecretRemoveUnmapped(t *testing.T) {
+	metadata := func(copiedKeys string, owner string) FakeVaultResponse {
+		return FakeVaultResponse{secret: &vault.Secret{Data: map[string]interface{}{
+			"custom_metadata": map[string]interface{}{
+				"owner":           owner,
+				"hvc-copied-keys": copiedKeys,
+			},
+		}}}
+	}
+
+	recordPatch := func(copiedKeys string) FakeVaultWrite {
+		return FakeVaultWrite{path: "kv/metadata/p1", data: map[string]interface{}{
+			"custom_metadata": map[string]interface{}{"hvc-copied-keys": copiedKeys},
+		}}
+	}
+
+	dataPatch := FakeVaultWrite{path: "kv/data/p1", data: map[string]interface{}{
+		"data":    map[string]interface{}{"k1": "v1", "k2": "v2", "old": nil},
+		"options": map[string]interface{}{"cas": 3},
+	}}
+
+	for _, testcase := range []struct {
+		conflictRetries int
+		readResponses   []FakeVaultResponse
+		patchResponses  []FakeVaultResponse
+		expectedPatches []FakeVaultWrite
+		expectedWrites  []FakeVaultWrite
+		expectedError   string
+	}{
+		// The copied keys are patched into the custom metadata before and
+		// after the target secret is patched.
+		{
+			readResponses: []FakeVaultResponse{metadata(`["k1","old"]`, "team-b")},
+			patchResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{}},
+				{secret: &vault.Secret{}},
+				{secret: &vault.Secret{}},
+			},
+			expectedPatches: []FakeVaultWrite{recordPatch(`["k1","k2","old"]`), dataPatch, recordPatch(`["k1","k2"]`)},
+		},
+		// Failing to record the copied keys once the target secret is
+		// patched leaves the new keys recorded along with the removed ones.
+		{
+			readResponses: []FakeVaultResponse{metadata(`["k1","old"]`, "team-b")},
+			patchResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{}},
+				{secret: &vault.Secret{}},
+				{err: errors.New("permission denied")},
+			},
+			expectedPatches: []FakeVaultWrite{recordPatch(`["k1","k2","old"]`), dataPatch, recordPatch(`["k1","k2"]`)},
+			expectedError:   `failed to record the copied keys in target secret "kv/p1" metadata: permission denied`,
+		},
+		// The custom metadata is read and written back when the Vault server
+		// can't patch it.
+		{
+			readResponses: []FakeVaultResponse{
+				metadata(`["k1","k2","old"]`, "team-b"),
+				metadata(`["k1","k2","old"]`, "team-b"),
+				metadata(`["k1","k2","old"]`, "team-b"),
+			},
+			patchResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{}},
+				{err: &vault.ResponseError{StatusCode: 405}},
+			},
+			expectedPatches: []FakeVaultWrite{dataPatch, recordPatch(`["k1","k2"]`)},
+			expectedWrites: []FakeVaultWrite{{path: "kv/metadata/p1", data: map[string]interface{}{"custom_metadata": map[string]interface{}{
+				"owner":           "team-b",
+				"hvc-copied-keys": `["k1","k2"]`,
+			}}}},
+		},
+		// The custom metadata is read again when another writer changes it.
+		{
+			conflictRetries: 1,
+			readResponses: []FakeVaultResponse{
+				metadata(`["k1","k2","old"]`, "team-b"),
+				metadata(`["k1","k2","old"]`, "team-b"),
+				metadata(`["k1","k2","old"]`, "team-c"),
+				metadata(`["k1","k2","old"]`, "team-c"),
+				metadata(`["k1","k2","old"]`, "team-c"),
+			},
+			patchResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{}},
+				{err: &vault.ResponseError{StatusCode: 405}},
+			},
+			expectedPatches: []FakeVaultWrite{dataPatch, recordPatch(`["k1","k2"]`)},
+			expectedWrites: []FakeVaultWrite{{path: "kv/metadata/p1", data: map[string]interface{}{"custom_metadata": map[string]interface{}{
+				"owner":           "team-c",
+				"hvc-copied-keys": `["k1","k2"]`,
+			}}}},
+		},
+		// The custom metadata keeps changing.
+		{
+			readResponses: []FakeVaultResponse{
+				metadata(`["k1","k2","old"]`, "team-b"),
+				metadata(`["k1","k2","old"]`, "team-b"),
+				metadata(`["k1","k2","old"]`, "team-c"),
+			},
+			patchResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{}},
+				{err: &vault.ResponseError{StatusCode: 405}},
+			},
+			expectedPatches: []FakeVaultWrite{dataPatch, recordPatch(`["k1","k2"]`)},
+			expectedError:   `failed to record the copied keys in target secret "kv/p1" metadata: target secret was changed by another writer since it was checked`,
+		},
+	} {
+		target := &FakeVault{
+			name:           "target",
+			readResponses:  testcase.readResponses,
+			patchResponses: testcase.patchResponses,
+			writeResponses: []FakeVaultResponse{{secret: &vault.Secret{}}},
+		}
+
+		copy := &Copy{MountPoint: "kv", Path: "p1", KVVersion: 2, Merge: true, RemoveUnmapped: true, ConflictRetries: testcase.conflictRetries}
+
+		err := copy.mergeTargetSecret(target, map[string]interface{}{"k1": "v1", "k2": "v2"}, 3)
+		if testcase.expectedError != "" {
+			assert.EqualError(t, err, testcase.expectedError)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, testcase.expectedPatches, target.patches)
+		assert.Equal(t, testcase.expectedWrites, target.writes)
+		assert.Empty(t, target.readResponses)
+	}
+
+	err := (&Copy{MountPoint: "kv", Path: "p1", KVVersion: 1, Merge: true, RemoveUnmapped: true}).mergeTargetSecret(&FakeVault{name: "target"}, nil, 0)
+	assert.EqualError(t, err, `removing the unmapped keys of target secret "kv/p1" requires a KV version 2 secrets engine`)
+}
+
+func TestDetermineContentChangedMerge(t *testing.T) {
+	for _, testcase := range []struct {
+		targetData      map[string]interface{}
+		expectedChanged bool
+	}{
+		{
+			targetData:      map[string]interface{}{"k1": "v1", "other": "value"},
+			expectedChanged: false,
+		},
+		{
+			targetData:      map[string]interface{}{"k1": "v0", "other": "value"},
+			expectedChanged: true,
+		},
+	} {
+		copy := &Copy{
+			MountPoint: "kv",
+			Path:       "p1",
+			KVVersion:  1,
+			Merge:      true,
+			SourceSecret: &CopySourceSecret{
+				secret: &CopyValue{
+					Source: &FakeVault{
+						name:          "s1",
+						readResponses: []FakeVaultResponse{{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v1"}}}},
+					},
+					MountPoint: "kv",
+					Path:       "p1",
+					KVVersion:  1,
+				},
+			},
+		}
+
+		target := &FakeVault{
+			name:          "target",
+			readResponses: []FakeVaultResponse{{secret: &vault.Secret{Data: testcase.targetData}}},
+		}
+
+		changed, err := copy.DetermineContentChanged(target)
+		assert.NoError(t, err)
+		assert.Equal(t, testcase.expectedChanged, changed)
+	}
+}
+
+func TestDetermineNeedToUpdateMerge(t *testing.T) {
+	for _, testcase := range []struct {
+		targetData          map[string]interface{}
+		expectedNeedsUpdate bool
+	}{
+		// Another writer updated the target secret after the source secret
+		// changed.
+		{
+			targetData:          map[string]interface{}{"k1": "v0", "other": "value"},
+			expectedNeedsUpdate: true,
+		},
+		{
+			targetData:          map[string]interface{}{"k1": "v1", "other": "value"},
+			expectedNeedsUpdate: false,
+		},
+	} {
+		copy := &Copy{
+			MountPoint: "kv",
+			Path:       "p1",
+			KVVersion:  2,
+			Merge:      true,
+			SourceSecret: &CopySourceSecret{
+				secret: &CopyValue{
+					Source: &FakeVault{
+						name:          "s1",
+						readResponses: []FakeVaultResponse{{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}}},
+					},
+					MountPoint: "kv",
+					Path:       "p1",
+					KVVersion:  2,
+				},
+			},
+		}
+
+		target := &FakeVault{
+			name: "target",
+			readResponses: []FakeVaultResponse{{secret: &vault.Secret{Data: map[string]interface{}{
+				"data":     testcase.targetData,
+				"metadata": map[string]interface{}{"version": json.Number("5")},
+			}}}},
+		}
+
+		needsUpdate, version, err := copy.determineNeedToUpdate(target)
+		assert.NoError(t, err)
+		assert.Equal(t, testcase.expectedNeedsUpdate, needsUpdate)
+		assert.Equal(t, 5, version)
+		assert.Equal(t, []string{"kv/data/p1"}, target.reads)
+	}
+}
@@ -0,0 +1,369 @@
+package hvc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/marcboudreau/hvc/spec"
+)
+
+// PlanAction describes what executing a Copy would do to its target secret.
+type PlanAction string
+
+const (
+	// PlanActionCreate indicates that the target secret would be created.
+	PlanActionCreate PlanAction = "create"
+
+	// PlanActionUpdate indicates that the target secret would be updated.
+	PlanActionUpdate PlanAction = "update"
+
+	// PlanActionSkip indicates that the target secret is up to date.
+	PlanActionSkip PlanAction = "skip"
+
+	// PlanActionDelete indicates that the target secret would be deleted by a
+	// mirror.
+	PlanActionDelete PlanAction = "delete"
+)
+
+// KeyChangeType describes how a single key of a target secret changes.
+type KeyChangeType string
+
+const (
+	// KeyAdded indicates that the key is missing from the target secret.
+	KeyAdded KeyChangeType = "added"
+
+	// KeyRemoved indicates that the key only exists in the target secret.
+	KeyRemoved KeyChangeType = "removed"
+
+	// KeyChanged indicates that the key's value differs in the target secret.
+	KeyChanged KeyChangeType = "changed"
+)
+
+// KeyChange is a structure that describes the change of a single key of a
+// target secret. It never contains the values of the key.
+type KeyChange struct {
+	// Key is the key within the target secret.
+	Key string `json:"key"`
+
+	// Type describes how the key changes.
+	Type KeyChangeType `json:"type"`
+}
+
+// CopyPlan is a structure that describes what executing a Copy, or a Prune,
+// would do to its target secret, without revealing any secret value.
+type CopyPlan struct {
+	// Index is the index of the planned Copy in the Copies field of the
+	// CopyJob, or of the planned Prune in its Prunes field when Action is
+	// PlanActionDelete.
+	Index int `json:"index"`
+
+	// Name is the canonical name of the target secret.
+	Name string `json:"name"`
+
+	// Action is what would be done to the target secret.
+	Action PlanAction `json:"action"`
+
+	// Changes lists the key-level changes that would be made to the target
+	// secret. It's empty when Action is PlanActionSkip.
+	Changes []KeyChange `json:"changes,omitempty"`
+
+	// TargetVersion is the version of the target secret observed when
+	// planning. It's only recorded when the target secret would be written.
+	TargetVersion SecretVersion `json:"target-version"`
+
+	// SourceVersions maps the canonical name of each source secret to the
+	// version observed when planning. It's only recorded when the target
+	// secret would be written.
+	SourceVersions map[string]SecretVersion `json:"source-versions,omitempty"`
+}
+
+// Plan determines what executing the receiver would do to its target secret
+// using the provided target Vault interface and fingerprint key, without
+// writing anything.
+func (p *Copy) Plan(target Vault, key []byte) (*CopyPlan, error) {
+	target, err := withNamespace(target, p.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CopyPlan{
+		Name:   p.Name(),
+		Action: PlanActionSkip,
+	}
+
+	needsUpdate, _, err := p.determineNeedToUpdate(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if !needsUpdate {
+		return plan, nil
+	}
+
+	secret, err := target.Read(kvDataPath(p.KVVersion, p.MountPoint, p.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve target secret %q values: %w", p.Name(), err)
+	}
+
+	sourceData, err := p.SourceSecret.RetrieveSourceValues()
+	if err != nil {
+		return nil, err
+	}
+
+	targetData := kvSecretData(p.KVVersion, secret)
+	if targetData == nil {
+		plan.Action = PlanActionCreate
+	} else {
+		plan.Action = PlanActionUpdate
+	}
+
+	desiredData, err := p.desiredData(target, targetData, sourceData)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Changes = diffKeys(targetData, desiredData)
+
+	plan.TargetVersion, err = p.TargetVersion(target, key)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.SourceVersions, err = p.SourceVersions(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// Verify makes sure that neither the target secret nor any source secret of
+// the receiver changed since the provided CopyPlan was made with the provided
+// fingerprint key.
+func (p *Copy) Verify(target Vault, plan *CopyPlan, key []byte) error {
+	target, err := withNamespace(target, p.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if plan.Name != p.Name() {
+		return fmt.Errorf("planned target secret %q does not match target secret %q", plan.Name, p.Name())
+	}
+
+	targetVersion, err := p.TargetVersion(target, key)
+	if err != nil {
+		return err
+	}
+
+	if targetVersion != plan.TargetVersion {
+		return fmt.Errorf("target secret %q changed since planning", p.Name())
+	}
+
+	sourceVersions, err := p.SourceVersions(key)
+	if err != nil {
+		return err
+	}
+
+	for name, version := range sourceVersions {
+		if plannedVersion, found := plan.SourceVersions[name]; !found || plannedVersion != version {
+			return fmt.Errorf("source secret %q changed since planning", name)
+		}
+	}
+
+	return nil
+}
+
+// Plan determines what executing every Copy and Prune of the receiver would do
+// to the target Vault server, without writing anything. The returned slice
+// holds one CopyPlan per Copy, in the same order, followed by one CopyPlan per
+// Prune, with nil entries for the copies and prunes that failed.
+func (p *CopyJob) Plan() ([]*CopyPlan, []error) {
+	plans := make([]*CopyPlan, len(p.Copies), len(p.Copies)+len(p.Prunes))
+	errorSlice := make([]error, len(p.Copies), len(p.Copies)+len(p.Prunes))
+
+	waitGroup := sync.WaitGroup{}
+
+	for i, copy := range p.Copies {
+		waitGroup.Add(1)
+		go func(copy *Copy, i int) {
+			plan, err := copy.Plan(p.Target, p.FingerprintKey)
+			if err != nil {
+				errorSlice[i] = fmt.Errorf("failed to plan copy %d: %w", i, err)
+			} else {
+				plan.Index = i
+			}
+
+			plans[i] = plan
+			waitGroup.Done()
+		}(copy, i)
+	}
+
+	waitGroup.Wait()
+
+	for i, prune := range p.Prunes {
+		plan, err := prune.Plan(p.Target, p.FingerprintKey)
+		if err != nil {
+			errorSlice = append(errorSlice, fmt.Errorf("failed to plan prune %d: %w", i, err))
+		} else {
+			plan.Index = i
+		}
+
+		plans = append(plans, plan)
+	}
+
+	return plans, compactErrors(errorSlice)
+}
+
+// Apply writes the target secrets of the provided plans, which must have been
+// made by the Plan function for the same copy job specification. Before
+// anything is written, every planned target and source secret is verified, and
+// if any of them changed since planning, nothing is written and the errors are
+// returned. The target secrets planned to be deleted are only deleted once
+// every other target secret is written.
+func (p *CopyJob) Apply(plans []*CopyPlan) []error {
+	planned := []*CopyPlan{}
+	deletes := []*CopyPlan{}
+	errorSlice := []error{}
+
+	for _, plan := range plans {
+		if plan.Action == PlanActionSkip {
+			continue
+		}
+
+		if plan.Action == PlanActionDelete {
+			if plan.Index < 0 || plan.Index >= len(p.Prunes) {
+				errorSlice = append(errorSlice, fmt.Errorf("planned prune %d does not exist", plan.Index))
+				continue
+			}
+
+			if err := p.Prunes[plan.Index].Verify(p.Target, plan, p.FingerprintKey); err != nil {
+				errorSlice = append(errorSlice, fmt.Errorf("failed to verify prune %d: %w", plan.Index, err))
+				continue
+			}
+
+			deletes = append(deletes, plan)
+			continue
+		}
+
+		if plan.Index < 0 || plan.Index >= len(p.Copies) {
+			errorSlice = append(errorSlice, fmt.Errorf("planned copy %d does not exist", plan.Index))
+			continue
+		}
+
+		if err := p.Copies[plan.Index].Verify(p.Target, plan, p.FingerprintKey); err != nil {
+			errorSlice = append(errorSlice, fmt.Errorf("failed to verify copy %d: %w", plan.Index, err))
+			continue
+		}
+
+		planned = append(planned, plan)
+	}
+
+	if len(errorSlice) > 0 {
+		return errorSlice
+	}
+
+	for _, plan := range planned {
+		copy := p.Copies[plan.Index]
+
+		target, err := withNamespace(p.Target, copy.Namespace)
+		if err == nil {
+			err = copy.UpdateTargetSecret(target, plan.TargetVersion.Version)
+		}
+
+		if err != nil {
+			errorSlice = append(errorSlice, fmt.Errorf("failed to apply copy %d: %w", plan.Index, err))
+		}
+	}
+
+	if len(errorSlice) > 0 {
+		return errorSlice
+	}
+
+	for _, plan := range deletes {
+		if err := p.Prunes[plan.Index].Execute(p.Target); err != nil {
+			errorSlice = append(errorSlice, fmt.Errorf("failed to apply prune %d: %w", plan.Index, err))
+		}
+	}
+
+	return errorSlice
+}
+
+// PlanFile is a structure that records the plans made for copy job
+// specification files, so that they can be applied later. It never contains
+// secret values.
+type PlanFile struct {
+	// SpecFiles holds the paths of the copy job specification files, or
+	// directories of copy job specification files, that were planned.
+	SpecFiles []string `json:"spec-files"`
+
+	// SpecOverlays holds the paths of the overlay files that were applied to
+	// the copy job specification.
+	SpecOverlays []string `json:"spec-overlays,omitempty"`
+
+	// SpecDigest is a SHA-256 hash of the contents of every loaded copy job
+	// specification file, including the included ones and the overlays, as
+	// they were read when planning, used to make sure that none of them
+	// changed since planning.
+	SpecDigest string `json:"spec-digest"`
+
+	// SpecFormat is the format in which the copy job specification files are
+	// written, or empty if it's determined by their extensions.
+	SpecFormat spec.Format `json:"spec-format,omitempty"`
+
+	// SpecLenient indicates that the unknown fields of the copy job
+	// specification files were ignored when planning.
+	SpecLenient bool `json:"spec-lenient,omitempty"`
+
+	// Plans holds the CopyPlan of every Copy of the copy job.
+	Plans []*CopyPlan `json:"plans"`
+}
+
+// FingerprintKeyFile returns the path of the file holding the fingerprint key
+// of the plan file at the provided path. The key is kept apart from the plan
+// file, so that the fingerprints recorded in the plan file can't be used to
+// guess the values of KV version 1 secrets.
+func FingerprintKeyFile(planFile string) string {
+	return planFile + ".key"
+}
+
+// diffKeys compares the provided current and desired key-value pairs and
+// returns the key-level changes, sorted by key.
+func diffKeys(current, desired map[string]interface{}) []KeyChange {
+	changes := []KeyChange{}
+
+	for key, value := range desired {
+		currentValue, found := current[key]
+		switch {
+		case !found:
+			changes = append(changes, KeyChange{Key: key, Type: KeyAdded})
+		case !reflect.DeepEqual(currentValue, value):
+			changes = append(changes, KeyChange{Key: key, Type: KeyChanged})
+		}
+	}
+
+	for key := range current {
+		if _, found := desired[key]; !found {
+			changes = append(changes, KeyChange{Key: key, Type: KeyRemoved})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// compactErrors returns the non-nil errors of the provided slice.
+func compactErrors(errorSlice []error) []error {
+	compacted := []error{}
+	for _, err := range errorSlice {
+		if err != nil {
+			compacted = append(compacted, err)
+		}
+	}
+
+	return compacted
+}
@@ -0,0 +1,268 @@
+package hvc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffKeys(t *testing.T) {
+	changes := diffKeys(
+		map[string]interface{}{"same": "v", "changed": "old", "removed": "v"},
+		map[string]interface{}{"same": "v", "changed": "new", "added": "v"},
+	)
+
+	assert.Equal(t, []KeyChange{
+		{Key: "added", Type: KeyAdded},
+		{Key: "changed", Type: KeyChanged},
+		{Key: "removed", Type: KeyRemoved},
+	}, changes)
+}
+
+func TestCopyPlan(t *testing.T) {
+	for _, testcase := range []struct {
+		targetResponses []FakeVaultResponse
+		sourceResponses []FakeVaultResponse
+		expectedPlan    *CopyPlan
+	}{
+		// Target secret doesn't exist
+		{
+			targetResponses: []FakeVaultResponse{
+				// metadata read
+				{secret: nil},
+				// data read
+				{secret: nil},
+				// version read
+				{secret: nil},
+			},
+			sourceResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"updated_time": "2022-01-01T00:00:00.000000000Z"}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"current_version": json.Number("3")}}},
+			},
+			expectedPlan: &CopyPlan{
+				Name:           "kv/p1",
+				Action:         PlanActionCreate,
+				Changes:        []KeyChange{{Key: "k1", Type: KeyAdded}},
+				SourceVersions: map[string]SecretVersion{"s1: kv/p1": {Version: 3}},
+			},
+		},
+		// Target secret is outdated
+		{
+			targetResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"updated_time": "2000-01-01T00:00:00.000000000Z"}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "old"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"current_version": json.Number("7")}}},
+			},
+			sourceResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"updated_time": "2022-01-01T00:00:00.000000000Z"}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "new"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"current_version": json.Number("2")}}},
+			},
+			expectedPlan: &CopyPlan{
+				Name:           "kv/p1",
+				Action:         PlanActionUpdate,
+				Changes:        []KeyChange{{Key: "k1", Type: KeyChanged}},
+				TargetVersion:  SecretVersion{Version: 7},
+				SourceVersions: map[string]SecretVersion{"s1: kv/p1": {Version: 2}},
+			},
+		},
+		// Target secret is up to date
+		{
+			targetResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"updated_time": "2022-01-01T00:00:00.000000000Z"}}},
+			},
+			sourceResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"updated_time": "2000-01-01T00:00:00.000000000Z"}}},
+			},
+			expectedPlan: &CopyPlan{
+				Name:   "kv/p1",
+				Action: PlanActionSkip,
+			},
+		},
+	} {
+		target := &FakeVault{
+			name:          "_target",
+			readResponses: testcase.targetResponses,
+		}
+
+		copy := &Copy{
+			MountPoint: "kv",
+			Path:       "p1",
+			SourceSecret: &CopySourceSecret{
+				secret: &CopyValue{
+					Source: &FakeVault{
+						name:          "s1",
+						readResponses: testcase.sourceResponses,
+					},
+					MountPoint: "kv",
+					Path:       "p1",
+				},
+			},
+		}
+
+		plan, err := copy.Plan(target, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, testcase.expectedPlan, plan)
+		assert.Empty(t, target.writes)
+	}
+}
+
+func TestReadSecretVersionKVVersion1(t *testing.T) {
+	fakeVault := &FakeVault{
+		name: "fake",
+		readResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v1"}}},
+			{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v1"}}},
+			{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v2"}}},
+			{secret: nil},
+		},
+	}
+
+	key, err := NewFingerprintKey()
+	assert.NoError(t, err)
+
+	otherKey, err := NewFingerprintKey()
+	assert.NoError(t, err)
+
+	first, err := readSecretVersion(fakeVault, 1, "secret", "p1", key)
+	assert.NoError(t, err)
+	assert.Len(t, first.Fingerprint, 64)
+	assert.NotContains(t, first.Fingerprint, "v1")
+
+	// The fingerprint can't be recomputed without the key.
+	unsalted := sha256.Sum256([]byte(`{"k1":"v1"}`))
+	assert.NotEqual(t, hex.EncodeToString(unsalted[:]), first.Fingerprint)
+
+	otherFirst, err := readSecretVersion(fakeVault, 1, "secret", "p1", otherKey)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, otherFirst)
+
+	second, err := readSecretVersion(fakeVault, 1, "secret", "p1", key)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	missing, err := readSecretVersion(fakeVault, 1, "secret", "p1", key)
+	assert.NoError(t, err)
+	assert.Equal(t, SecretVersion{}, missing)
+
+	_, err = readSecretVersion(fakeVault, 1, "secret", "p1", nil)
+	assert.EqualError(t, err, "no fingerprint key provided")
+	assert.Len(t, fakeVault.reads, 4)
+}
+
+func TestCopyJobApply(t *testing.T) {
+	for _, testcase := range []struct {
+		targetVersion    string
+		errorSliceAssert func(assert.TestingT, interface{}, ...interface{}) bool
+		expectedWrites   int
+	}{
+		// Nothing changed since planning
+		{
+			targetVersion:    "7",
+			errorSliceAssert: assert.Empty,
+			expectedWrites:   1,
+		},
+		// Target secret changed since planning
+		{
+			targetVersion:    "8",
+			errorSliceAssert: assert.NotEmpty,
+			expectedWrites:   0,
+		},
+	} {
+		target := &FakeVault{
+			name: "_target",
+			readResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"current_version": json.Number(testcase.targetVersion)}}},
+			},
+			writeResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{}},
+			},
+		}
+
+		copyJob := &CopyJob{
+			Target: target,
+			Copies: []*Copy{
+				{
+					MountPoint: "kv",
+					Path:       "p1",
+					SourceSecret: &CopySourceSecret{
+						secret: &CopyValue{
+							Source: &FakeVault{
+								name: "s1",
+								readResponses: []FakeVaultResponse{
+									// version read
+									{secret: &vault.Secret{Data: map[string]interface{}{"current_version": json.Number("2")}}},
+									// data read
+									{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "new"}}}},
+								},
+							},
+							MountPoint: "kv",
+							Path:       "p1",
+						},
+					},
+				},
+			},
+		}
+
+		errorSlice := copyJob.Apply([]*CopyPlan{
+			{
+				Index:          0,
+				Name:           "kv/p1",
+				Action:         PlanActionUpdate,
+				TargetVersion:  SecretVersion{Version: 7},
+				SourceVersions: map[string]SecretVersion{"s1: kv/p1": {Version: 2}},
+			},
+		})
+		testcase.errorSliceAssert(t, errorSlice)
+		assert.Len(t, target.writes, testcase.expectedWrites)
+	}
+}
+
+func TestCopyJobApplyDelete(t *testing.T) {
+	for _, testcase := range []struct {
+		targetVersion    string
+		errorSliceAssert func(assert.TestingT, interface{}, ...interface{}) bool
+		expectedDeletes  []string
+	}{
+		// Nothing changed since planning
+		{
+			targetVersion:    "3",
+			errorSliceAssert: assert.Empty,
+			expectedDeletes:  []string{"kv/metadata/p2"},
+		},
+		// Target secret changed since planning
+		{
+			targetVersion:    "4",
+			errorSliceAssert: assert.NotEmpty,
+		},
+	} {
+		target := &FakeVault{
+			name: "_target",
+			readResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"current_version": json.Number(testcase.targetVersion)}}},
+			},
+			deleteResponses: []FakeVaultResponse{{}},
+		}
+
+		copyJob := &CopyJob{
+			Target: target,
+			Prunes: []*Prune{{MountPoint: "kv", Path: "p2", KVVersion: 2, DeleteMetadata: true}},
+		}
+
+		errorSlice := copyJob.Apply([]*CopyPlan{
+			{
+				Index:         0,
+				Name:          "kv/p2",
+				Action:        PlanActionDelete,
+				TargetVersion: SecretVersion{Version: 3},
+			},
+		})
+		testcase.errorSliceAssert(t, errorSlice)
+		assert.Equal(t, testcase.expectedDeletes, target.deletes)
+	}
+}
@@ -0,0 +1,281 @@
+package hvc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/marcboudreau/hvc/spec"
+)
+
+// expandPrefixCopy creates a Copy structure for every secret found, recursively,
+// under the source prefix of the provided spec.Copy structure, which copies
+// that secret to the same relative path under the target prefix. The mount
+// points of both prefixes are resolved using the provided mountCache
+// structure. Only the secrets selected by the include and exclude patterns of
+// the source secret are copied, and the relative path of their target secret
+// is rewritten by the rewrite template if provided. Source secrets whose latest
+// version is deleted or destroyed are skipped. The returned slice is
+// sorted by target path. If the provided spec.Copy structure mirrors its
+// source prefix, a Prune structure is also returned for every target secret
+// under the target prefix that isn't copied.
+func (p *CopyJob) expandPrefixCopy(copySpec *spec.Copy, mounts *mountCache) ([]*Copy, []*Prune, error) {
+	if copySpec.Path != "" {
+		return nil, nil, fmt.Errorf("copy element cannot contain both path and prefix")
+	}
+
+	if copySpec.Secret == nil {
+		return nil, nil, fmt.Errorf("copy element with a prefix must provide a secret")
+	}
+
+	if copySpec.Secret.Path != "" {
+		return nil, nil, fmt.Errorf("secret of a copy element with a prefix cannot contain a path")
+	}
+
+	targetPrefix, err := spec.CleanPrefix(copySpec.Prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sourcePrefix := targetPrefix
+	if copySpec.Secret.Prefix != "" {
+		sourcePrefix, err = spec.CleanPrefix(copySpec.Secret.Prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The prefixes are resolved like the paths of a regular Copy, whose
+	// mount points and KV versions are shared by every expanded Copy. A prefix
+	// designates no secret, so it isn't looked for in the default kv mount.
+	prefixSpec := *copySpec
+	prefixSpec.Path = targetPrefix
+	prefixSpec.Prefix = ""
+
+	secretSpec := *copySpec.Secret
+	secretSpec.Path = sourcePrefix
+	secretSpec.Prefix = ""
+	prefixSpec.Secret = &secretSpec
+
+	prefixCopy, err := NewCopy(&prefixSpec, p.Sources)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := prefixCopy.resolveMounts(p.Target, mounts, false); err != nil {
+		return nil, nil, err
+	}
+
+	mapping, err := newPathMapping(copySpec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	source := prefixCopy.SourceSecret.(*CopySourceSecret).secret
+
+	relativePaths, err := listSecrets(source.Source, source.KVVersion, source.MountPoint, source.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	copies := []*Copy{}
+	sourcePaths := make(map[string]string)
+
+	for _, relativePath := range relativePaths {
+		targetPath, selected, err := mapping.targetPath(relativePath)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !selected {
+			continue
+		}
+
+		value := &CopyValue{
+			Source:     source.Source,
+			MountPoint: source.MountPoint,
+			Path:       source.Path + "/" + relativePath,
+			KVVersion:  source.KVVersion,
+		}
+
+		deleted, err := value.isDeleted()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if deleted {
+			continue
+		}
+
+		if sourcePath, found := sourcePaths[targetPath]; found {
+			return nil, nil, fmt.Errorf("source secrets %s and %s are both copied to target secret %s", sourcePath, relativePath, targetPath)
+		}
+
+		sourcePaths[targetPath] = relativePath
+
+		copies = append(copies, &Copy{
+			MountPoint:      prefixCopy.MountPoint,
+			Path:            prefixCopy.Path + "/" + targetPath,
+			Namespace:       prefixCopy.Namespace,
+			KVVersion:       prefixCopy.KVVersion,
+			Merge:           prefixCopy.Merge,
+			RemoveUnmapped:  prefixCopy.RemoveUnmapped,
+			ConflictRetries: prefixCopy.ConflictRetries,
+			SourceSecret:    &CopySourceSecret{secret: value},
+		})
+	}
+
+	sort.Slice(copies, func(i, j int) bool {
+		return copies[i].Path < copies[j].Path
+	})
+
+	if copySpec.Mirror == nil {
+		return copies, nil, nil
+	}
+
+	if err := copySpec.Mirror.Check(); err != nil {
+		return nil, nil, err
+	}
+
+	prunes, err := p.findPrunes(prefixCopy, copies, copySpec.Mirror)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return copies, prunes, nil
+}
+
+// pathMapping is a structure that selects the source secrets of a copy with a
+// prefix and determines the path of their target secrets.
+type pathMapping struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	rewrite string
+}
+
+// newPathMapping creates a pathMapping structure from the include and exclude
+// patterns and the rewrite template of the provided spec.Copy structure.
+func newPathMapping(copySpec *spec.Copy) (*pathMapping, error) {
+	include, err := compilePatterns(copySpec.Secret.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compilePatterns(copySpec.Secret.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pathMapping{
+		include: include,
+		exclude: exclude,
+		rewrite: copySpec.Rewrite,
+	}, nil
+}
+
+// compilePatterns compiles each of the provided patterns.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		expression, err := spec.CompilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled[i] = expression
+	}
+
+	return compiled, nil
+}
+
+// targetPath returns the path, relative to the target prefix, of the target
+// secret of the source secret at the provided path, relative to the source
+// prefix. The function returns false if the source secret isn't selected.
+func (p *pathMapping) targetPath(relativePath string) (string, bool, error) {
+	for _, expression := range p.exclude {
+		if expression.MatchString(relativePath) {
+			return "", false, nil
+		}
+	}
+
+	var expression *regexp.Regexp
+	var match []int
+
+	for _, include := range p.include {
+		if match = include.FindStringSubmatchIndex(relativePath); match != nil {
+			expression = include
+			break
+		}
+	}
+
+	if len(p.include) > 0 && expression == nil {
+		return "", false, nil
+	}
+
+	if p.rewrite == "" {
+		return relativePath, true, nil
+	}
+
+	if expression == nil {
+		expression = wholePath
+		match = wholePath.FindStringSubmatchIndex(relativePath)
+	}
+
+	targetPath := strings.Trim(string(expression.ExpandString(nil, p.rewrite, relativePath, match)), "/")
+	if targetPath == "" {
+		return "", false, fmt.Errorf("rewrite of source secret %s produces an empty target path", relativePath)
+	}
+
+	return targetPath, true, nil
+}
+
+// wholePath is the regular expression used to rewrite the path of a source
+// secret when no include pattern is provided.
+var wholePath = regexp.MustCompile("^.*$")
+
+// listSecrets returns the paths, relative to the provided prefix, of every
+// secret found under that prefix in the KV secrets engine of the provided
+// version mounted at the provided mount point, sorted lexically. The folders
+// returned by each LIST operation are listed recursively.
+func listSecrets(vault Vault, version int, mountPoint, prefix string) ([]string, error) {
+	secret, err := vault.List(kvListPath(version, mountPoint, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets under %s/%s in %s: %w", mountPoint, prefix, vault.Name(), err)
+	}
+
+	// A missing response indicates that nothing is found under the prefix.
+	if secret == nil || secret.Data == nil {
+		return []string{}, nil
+	}
+
+	keys, _ := secret.Data["keys"].([]interface{})
+
+	relativePaths := []string{}
+	for _, key := range keys {
+		name, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected key %v listed under %s/%s in %s", key, mountPoint, prefix, vault.Name())
+		}
+
+		if !strings.HasSuffix(name, "/") {
+			relativePaths = append(relativePaths, name)
+			continue
+		}
+
+		folder := strings.TrimSuffix(name, "/")
+
+		folderPaths, err := listSecrets(vault, version, mountPoint, prefix+"/"+folder)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, folderPath := range folderPaths {
+			relativePaths = append(relativePaths, folder+"/"+folderPath)
+		}
+	}
+
+	sort.Strings(relativePaths)
+
+	return relativePaths, nil
+}
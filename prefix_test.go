@@ -0,0 +1,203 @@
+package hvc
+
+import (
+	"errors"
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/marcboudreau/hvc/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPrefixCopy(t *testing.T) {
+	target := &FakeVault{name: "target"}
+	source := &FakeVault{
+		name: "s1",
+		listResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"db/", "api"}}}},
+			{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"password", "replica/"}}}},
+			{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"password"}}}},
+		},
+	}
+
+	copyJob := &CopyJob{Target: target, Sources: map[string]Vault{"s1": source}}
+
+	copies, _, err := copyJob.expandPrefixCopy(&spec.Copy{
+		MountPoint: "kv",
+		Prefix:     "/team-a/",
+		KVVersion:  2,
+		Secret: &spec.CopyValue{
+			Source:     "s1",
+			MountPoint: "secret",
+			Prefix:     "teams/a",
+			KVVersion:  1,
+		},
+	}, newMountCache())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"secret/teams/a", "secret/teams/a/db", "secret/teams/a/db/replica"}, source.lists)
+
+	targetPaths := []string{}
+	sourcePaths := []string{}
+	for _, copy := range copies {
+		assert.Equal(t, "kv", copy.MountPoint)
+		assert.Equal(t, 2, copy.KVVersion)
+
+		value := copy.SourceSecret.(*CopySourceSecret).secret
+		assert.Equal(t, source, value.Source)
+		assert.Equal(t, "secret", value.MountPoint)
+		assert.Equal(t, 1, value.KVVersion)
+
+		targetPaths = append(targetPaths, copy.Path)
+		sourcePaths = append(sourcePaths, value.Path)
+	}
+
+	assert.Equal(t, []string{"team-a/api", "team-a/db/password", "team-a/db/replica/password"}, targetPaths)
+	assert.Equal(t, []string{"teams/a/api", "teams/a/db/password", "teams/a/db/replica/password"}, sourcePaths)
+}
+
+func TestExpandPrefixCopyDefaultsSourcePrefix(t *testing.T) {
+	source := &FakeVault{
+		name: "s1",
+		listResponses: []FakeVaultResponse{
+			{secret: nil},
+		},
+	}
+
+	copyJob := &CopyJob{Target: &FakeVault{name: "target"}, Sources: map[string]Vault{"s1": source}}
+
+	copies, _, err := copyJob.expandPrefixCopy(&spec.Copy{
+		MountPoint: "kv",
+		Prefix:     "team-a",
+		KVVersion:  2,
+		Secret:     &spec.CopyValue{Source: "s1", MountPoint: "kv", KVVersion: 2},
+	}, newMountCache())
+	assert.NoError(t, err)
+	assert.Empty(t, copies)
+	assert.Equal(t, []string{"kv/metadata/team-a"}, source.lists)
+}
+
+func TestExpandPrefixCopyErrors(t *testing.T) {
+	for _, testcase := range []struct {
+		copySpec      *spec.Copy
+		listResponses []FakeVaultResponse
+		expectedError string
+	}{
+		{
+			copySpec:      &spec.Copy{Prefix: "a", Path: "b", Secret: &spec.CopyValue{Source: "s1"}},
+			expectedError: "copy element cannot contain both path and prefix",
+		},
+		{
+			copySpec:      &spec.Copy{Prefix: "a", Values: map[string]*spec.CopyValue{"k": {Source: "s1"}}},
+			expectedError: "copy element with a prefix must provide a secret",
+		},
+		{
+			copySpec:      &spec.Copy{Prefix: "a", Secret: &spec.CopyValue{Source: "s1", Path: "b"}},
+			expectedError: "secret of a copy element with a prefix cannot contain a path",
+		},
+		{
+			copySpec:      &spec.Copy{Prefix: "/", Secret: &spec.CopyValue{Source: "s1"}},
+			expectedError: "prefix must designate a path within the KV secrets engine",
+		},
+		{
+			copySpec:      &spec.Copy{MountPoint: "kv", KVVersion: 2, Prefix: "a", Secret: &spec.CopyValue{Source: "s1", MountPoint: "kv", KVVersion: 2}},
+			listResponses: []FakeVaultResponse{{err: errors.New("permission denied")}},
+			expectedError: "failed to list secrets under kv/a in s1: permission denied",
+		},
+	} {
+		source := &FakeVault{name: "s1", listResponses: testcase.listResponses}
+		copyJob := &CopyJob{Target: &FakeVault{name: "target"}, Sources: map[string]Vault{"s1": source}}
+
+		_, _, err := copyJob.expandPrefixCopy(testcase.copySpec, newMountCache())
+		assert.EqualError(t, err, testcase.expectedError)
+	}
+}
+
+func TestExpandPrefixCopySelection(t *testing.T) {
+	for _, testcase := range []struct {
+		rewrite             string
+		include             []string
+		exclude             []string
+		expectedTargetPaths []string
+		expectedSourcePaths []string
+		expectedError       string
+	}{
+		{
+			include:             []string{"*/db"},
+			expectedTargetPaths: []string{"prod/billing/db", "prod/legacy/db", "prod/svc-search/db"},
+			expectedSourcePaths: []string{"apps/billing/db", "apps/legacy/db", "apps/svc-search/db"},
+		},
+		{
+			rewrite:             "${1}/database",
+			include:             []string{"^svc-(.*)/db$", "*/db"},
+			exclude:             []string{"legacy/**"},
+			expectedTargetPaths: []string{"prod/billing/database", "prod/search/database"},
+			expectedSourcePaths: []string{"apps/billing/db", "apps/svc-search/db"},
+		},
+		{
+			rewrite:             "flat-${0}",
+			exclude:             []string{"*/db"},
+			expectedTargetPaths: []string{"prod/flat-billing/api"},
+			expectedSourcePaths: []string{"apps/billing/api"},
+		},
+		{
+			rewrite:       "db",
+			include:       []string{"*/db"},
+			expectedError: "source secrets billing/db and legacy/db are both copied to target secret db",
+		},
+		{
+			rewrite:       "${2}",
+			include:       []string{"*/db"},
+			expectedError: "rewrite of source secret billing/db produces an empty target path",
+		},
+	} {
+		source := &FakeVault{
+			name: "s1",
+			listResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"billing/", "legacy/", "svc-search/"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"api", "db"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"db"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"db"}}}},
+			},
+			readResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+			},
+		}
+
+		copyJob := &CopyJob{Target: &FakeVault{name: "target"}, Sources: map[string]Vault{"s1": source}}
+
+		copies, _, err := copyJob.expandPrefixCopy(&spec.Copy{
+			MountPoint: "kv",
+			Prefix:     "prod",
+			Rewrite:    testcase.rewrite,
+			KVVersion:  2,
+			Secret: &spec.CopyValue{
+				Source:     "s1",
+				MountPoint: "kv",
+				Prefix:     "apps",
+				KVVersion:  2,
+				Include:    testcase.include,
+				Exclude:    testcase.exclude,
+			},
+		}, newMountCache())
+
+		if testcase.expectedError != "" {
+			assert.EqualError(t, err, testcase.expectedError)
+			continue
+		}
+
+		assert.NoError(t, err)
+
+		targetPaths := []string{}
+		sourcePaths := []string{}
+		for _, copy := range copies {
+			targetPaths = append(targetPaths, copy.Path)
+			sourcePaths = append(sourcePaths, copy.SourceSecret.(*CopySourceSecret).secret.Path)
+		}
+
+		assert.Equal(t, testcase.expectedTargetPaths, targetPaths)
+		assert.Equal(t, testcase.expectedSourcePaths, sourcePaths)
+	}
+}
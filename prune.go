@@ -0,0 +1,187 @@
+package hvc
+
+import (
+	"fmt"
+
+	"github.com/marcboudreau/hvc/spec"
+)
+
+// Prune is a structure that defines a target secret that a mirror deletes,
+// because it isn't copied from any source secret.
+type Prune struct {
+	// MountPoint is the path where the target secret's KV secrets engine is
+	// mounted.
+	MountPoint string
+
+	// Path is the path of the target secret within the KV secrets engine.
+	Path string
+
+	// Namespace is the Vault Enterprise namespace of the target secret. When
+	// empty, the namespace of the target Vault connection is used.
+	Namespace string
+
+	// KVVersion is the version of the target secret's KV secrets engine.
+	KVVersion int
+
+	// DeleteMetadata indicates that every version and the metadata of the
+	// target secret are deleted, rather than its latest version only.
+	DeleteMetadata bool
+}
+
+// Name returns a canonical name for the receiver.
+func (p *Prune) Name() string {
+	return secretName(p.Namespace, p.MountPoint, p.Path)
+}
+
+// deletePath returns the API path used to delete the target secret.
+func (p *Prune) deletePath() string {
+	if p.KVVersion != 1 && p.DeleteMetadata {
+		return fmt.Sprintf("%s/metadata/%s", p.MountPoint, p.Path)
+	}
+
+	return kvDataPath(p.KVVersion, p.MountPoint, p.Path)
+}
+
+// Execute deletes the target secret of the receiver using the provided target
+// Vault interface.
+func (p *Prune) Execute(target Vault) error {
+	target, err := withNamespace(target, p.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if _, err := target.Delete(p.deletePath()); err != nil {
+		return fmt.Errorf("failed to delete target secret %q: %w", p.Name(), err)
+	}
+
+	return nil
+}
+
+// TargetVersion retrieves the SecretVersion of the target secret, using the
+// provided fingerprint key.
+func (p *Prune) TargetVersion(target Vault, key []byte) (SecretVersion, error) {
+	target, err := withNamespace(target, p.Namespace)
+	if err != nil {
+		return SecretVersion{}, err
+	}
+
+	version, err := readSecretVersion(target, p.KVVersion, p.MountPoint, p.Path, key)
+	if err != nil {
+		return SecretVersion{}, fmt.Errorf("failed to retrieve target secret %q version: %w", p.Name(), err)
+	}
+
+	return version, nil
+}
+
+// Plan describes the deletion of the target secret of the receiver using the
+// provided target Vault interface and fingerprint key, without deleting
+// anything.
+func (p *Prune) Plan(target Vault, key []byte) (*CopyPlan, error) {
+	version, err := p.TargetVersion(target, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CopyPlan{
+		Name:          p.Name(),
+		Action:        PlanActionDelete,
+		TargetVersion: version,
+	}, nil
+}
+
+// Verify makes sure that the target secret of the receiver didn't change since
+// the provided CopyPlan was made with the provided fingerprint key.
+func (p *Prune) Verify(target Vault, plan *CopyPlan, key []byte) error {
+	if plan.Name != p.Name() {
+		return fmt.Errorf("planned target secret %q does not match target secret %q", plan.Name, p.Name())
+	}
+
+	version, err := p.TargetVersion(target, key)
+	if err != nil {
+		return err
+	}
+
+	if version != plan.TargetVersion {
+		return fmt.Errorf("target secret %q changed since planning", p.Name())
+	}
+
+	return nil
+}
+
+// findPrunes lists the target secrets found under the target prefix of the
+// provided Copy structure, which holds the resolved prefixes of a copy with a
+// prefix, and returns a Prune structure for each one that isn't written by any
+// of the provided copies. Target secrets whose latest version is already
+// deleted are ignored when they would be soft deleted. An error is returned if
+// the proportion of target secrets to delete exceeds the threshold of the
+// provided spec.CopyMirror structure.
+func (p *CopyJob) findPrunes(prefixCopy *Copy, copies []*Copy, mirror *spec.CopyMirror) ([]*Prune, error) {
+	target, err := withNamespace(p.Target, prefixCopy.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	relativePaths, err := listSecrets(target, prefixCopy.KVVersion, prefixCopy.MountPoint, prefixCopy.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := make(map[string]bool)
+	for _, copy := range copies {
+		copied[copy.Path] = true
+	}
+
+	prunes := []*Prune{}
+	for _, relativePath := range relativePaths {
+		path := prefixCopy.Path + "/" + relativePath
+		if copied[path] {
+			continue
+		}
+
+		prune := &Prune{
+			MountPoint:     prefixCopy.MountPoint,
+			Path:           path,
+			Namespace:      prefixCopy.Namespace,
+			KVVersion:      prefixCopy.KVVersion,
+			DeleteMetadata: mirror.Delete == spec.MirrorDeleteMetadata,
+		}
+
+		if prune.KVVersion != 1 && !prune.DeleteMetadata {
+			secret, err := target.Read(kvDataPath(prune.KVVersion, prune.MountPoint, prune.Path))
+			if err != nil {
+				return nil, fmt.Errorf("failed to retrieve target secret %q values: %w", prune.Name(), err)
+			}
+
+			if kvSecretData(prune.KVVersion, secret) == nil {
+				continue
+			}
+		}
+
+		prunes = append(prunes, prune)
+	}
+
+	maxDeletePercent := mirror.MaxDeletePercent
+	if maxDeletePercent == 0 {
+		maxDeletePercent = spec.DefaultMirrorMaxDeletePercent
+	}
+
+	if len(prunes)*100 > maxDeletePercent*len(relativePaths) {
+		return nil, fmt.Errorf("mirror would delete %d of the %d target secrets under %s, which exceeds the %d%% threshold", len(prunes), len(relativePaths), secretName(prefixCopy.Namespace, prefixCopy.MountPoint, prefixCopy.Path), maxDeletePercent)
+	}
+
+	return prunes, nil
+}
+
+// executePrunes deletes the target secret of every Prune of the receiver using
+// its target Vault connection.
+func (p *CopyJob) executePrunes() []error {
+	errorSlice := []error{}
+
+	for i, prune := range p.Prunes {
+		if err := prune.Execute(p.Target); err != nil {
+			errorSlice = append(errorSlice, fmt.Errorf("failed to execute prune %d: %w", i, err))
+		}
+	}
+
+	return errorSlice
+}
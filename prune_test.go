@@ -0,0 +1,208 @@
+package hvc
+
+import (
+	"errors"
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/marcboudreau/hvc/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPrunes(t *testing.T) {
+	for _, testcase := range []struct {
+		mirror         *spec.CopyMirror
+		readResponses  []FakeVaultResponse
+		expectedPaths  []string
+		expectedReads  []string
+		expectedDelete string
+		expectedError  string
+	}{
+		// Soft deletes only the target secrets that still hold data
+		{
+			mirror: &spec.CopyMirror{MaxDeletePercent: 50},
+			readResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"data": nil}}},
+			},
+			expectedPaths:  []string{"team-a/old/db"},
+			expectedReads:  []string{"kv/data/team-a/old/db", "kv/data/team-a/stale"},
+			expectedDelete: "kv/data/team-a/old/db",
+		},
+		// Metadata deletes never read the target secrets
+		{
+			mirror:         &spec.CopyMirror{Delete: spec.MirrorDeleteMetadata, MaxDeletePercent: 50},
+			expectedPaths:  []string{"team-a/old/db", "team-a/stale"},
+			expectedDelete: "kv/metadata/team-a/old/db",
+		},
+		// Default threshold
+		{
+			mirror:        &spec.CopyMirror{Delete: spec.MirrorDeleteMetadata},
+			expectedError: "mirror would delete 2 of the 4 target secrets under kv/team-a, which exceeds the 10% threshold",
+		},
+	} {
+		target := &FakeVault{
+			name: "target",
+			listResponses: []FakeVaultResponse{
+				{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"api", "db", "old/", "stale"}}}},
+				{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"db"}}}},
+			},
+			readResponses: testcase.readResponses,
+		}
+
+		copyJob := &CopyJob{Target: target}
+
+		prunes, err := copyJob.findPrunes(
+			&Copy{MountPoint: "kv", Path: "team-a", KVVersion: 2},
+			[]*Copy{
+				{MountPoint: "kv", Path: "team-a/api", KVVersion: 2},
+				{MountPoint: "kv", Path: "team-a/db", KVVersion: 2},
+			},
+			testcase.mirror,
+		)
+
+		if testcase.expectedError != "" {
+			assert.EqualError(t, err, testcase.expectedError)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"kv/metadata/team-a", "kv/metadata/team-a/old"}, target.lists)
+		assert.Equal(t, testcase.expectedReads, target.reads)
+
+		paths := []string{}
+		for _, prune := range prunes {
+			paths = append(paths, prune.Path)
+		}
+
+		assert.Equal(t, testcase.expectedPaths, paths)
+		assert.Equal(t, testcase.expectedDelete, prunes[0].deletePath())
+	}
+}
+
+func TestExpandPrefixCopyMirror(t *testing.T) {
+	source := &FakeVault{
+		name: "s1",
+		listResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"api"}}}},
+		},
+	}
+
+	target := &FakeVault{
+		name: "target",
+		listResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"api", "db"}}}},
+		},
+	}
+
+	copyJob := &CopyJob{Target: target, Sources: map[string]Vault{"s1": source}}
+
+	copies, prunes, err := copyJob.expandPrefixCopy(&spec.Copy{
+		MountPoint: "kv",
+		Prefix:     "team-a",
+		KVVersion:  1,
+		Mirror:     &spec.CopyMirror{MaxDeletePercent: 50},
+		Secret:     &spec.CopyValue{Source: "s1", MountPoint: "kv", KVVersion: 1},
+	}, newMountCache())
+	assert.NoError(t, err)
+	assert.Len(t, copies, 1)
+	assert.Equal(t, []*Prune{{MountPoint: "kv", Path: "team-a/db", KVVersion: 1}}, prunes)
+	assert.Equal(t, []string{"kv/team-a"}, target.lists)
+}
+
+func TestCopyJobExecutePrunes(t *testing.T) {
+	for _, testcase := range []struct {
+		writeResponses  []FakeVaultResponse
+		expectedDeletes []string
+		expectedErrors  int
+	}{
+		// Every copy succeeded
+		{
+			writeResponses:  []FakeVaultResponse{{secret: &vault.Secret{}}},
+			expectedDeletes: []string{"kv/p2"},
+		},
+		// A copy failed
+		{
+			writeResponses: []FakeVaultResponse{{err: errors.New("permission denied")}},
+			expectedErrors: 1,
+		},
+	} {
+		target := &FakeVault{
+			name:            "target",
+			readResponses:   []FakeVaultResponse{{secret: nil}},
+			writeResponses:  testcase.writeResponses,
+			deleteResponses: []FakeVaultResponse{{}},
+		}
+
+		copyJob := &CopyJob{
+			Target: target,
+			Copies: []*Copy{
+				{
+					MountPoint: "kv",
+					Path:       "p1",
+					KVVersion:  1,
+					SourceSecret: &CopySourceSecret{
+						secret: &CopyValue{
+							Source: &FakeVault{
+								name: "s1",
+								readResponses: []FakeVaultResponse{
+									{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v1"}}},
+									{secret: &vault.Secret{Data: map[string]interface{}{"k1": "v1"}}},
+								},
+							},
+							MountPoint: "kv",
+							Path:       "p1",
+							KVVersion:  1,
+						},
+					},
+				},
+			},
+			Prunes: []*Prune{{MountPoint: "kv", Path: "p2", KVVersion: 1}},
+		}
+
+		errorSlice := copyJob.Execute()
+		assert.Len(t, errorSlice, testcase.expectedErrors)
+		assert.Equal(t, testcase.expectedDeletes, target.deletes)
+	}
+}
+
+func TestExpandPrefixCopyMirrorDeletedSource(t *testing.T) {
+	source := &FakeVault{
+		name: "s1",
+		listResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"api", "db"}}}},
+		},
+		readResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+			// The latest version of the source secret is deleted, but its
+			// metadata is kept.
+			{secret: &vault.Secret{Data: map[string]interface{}{"data": nil, "metadata": map[string]interface{}{"deletion_time": "2022-04-08T13:01:34.000000000Z"}}}},
+		},
+	}
+
+	target := &FakeVault{
+		name: "target",
+		listResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"keys": []interface{}{"api", "db"}}}},
+		},
+		readResponses: []FakeVaultResponse{
+			{secret: &vault.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"k1": "v1"}}}},
+		},
+	}
+
+	copyJob := &CopyJob{Target: target, Sources: map[string]Vault{"s1": source}}
+
+	copies, prunes, err := copyJob.expandPrefixCopy(&spec.Copy{
+		MountPoint: "kv",
+		Prefix:     "team-a",
+		KVVersion:  2,
+		Mirror:     &spec.CopyMirror{MaxDeletePercent: 50},
+		Secret:     &spec.CopyValue{Source: "s1", MountPoint: "kv", KVVersion: 2},
+	}, newMountCache())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kv/data/team-a/api", "kv/data/team-a/db"}, source.reads)
+
+	assert.Len(t, copies, 1)
+	assert.Equal(t, "team-a/api", copies[0].Path)
+	assert.Equal(t, []*Prune{{MountPoint: "kv", Path: "team-a/db", KVVersion: 2}}, prunes)
+}
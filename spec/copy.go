@@ -1,22 +1,151 @@
 package spec
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // Copy contains the specification for a single secret in the target Vault
 // server including all of the source values used to update this secret.
 type Copy struct {
+	// ID identifies the copy so that overlays can modify it. It must be unique
+	// within the copy job specification.
+	ID string `json:"id,omitempty"`
+
 	// MountPoint is the path where the KV secrets engine is mounted in the target
 	// Vault server.
-	MountPoint string `json:"mount-point"`
+	MountPoint string `json:"mount-point,omitempty"`
 
 	// Path is the path of the copied secret within the KV secrets engine in the
 	// target Vault server.
-	Path string `json:"path"`
+	Path string `json:"path,omitempty"`
+
+	// Prefix is the path, within the KV secrets engine in the target Vault
+	// server, under which every secret found under the prefix of the source
+	// secret is copied, recursively. Only one of Path and Prefix can be used for
+	// any Copy instance, and Prefix requires Secret.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Rewrite is the template of the path, relative to Prefix, of the target
+	// secret of each source secret selected by a Copy instance with a Prefix.
+	// Its ${N} references are replaced with the Nth capture group of the first
+	// include pattern of Secret that matches the path of the source secret,
+	// relative to the source prefix, and ${0} with the whole match. By default,
+	// the relative path of the source secret is used as-is.
+	Rewrite string `json:"rewrite,omitempty"`
+
+	// Mirror enables the deletion of the target secrets found under Prefix
+	// that aren't copied from a source secret, such as the copies of source
+	// secrets that were deleted. It's only used by a Copy instance with a
+	// Prefix.
+	Mirror *CopyMirror `json:"mirror,omitempty"`
+
+	// ConflictRetries is the number of times the copy is retried when the
+	// target secret is changed by another writer while it's being copied.
+	ConflictRetries int `json:"conflict-retries,omitempty"`
+
+	// Merge preserves the keys of the target secret that aren't copied from a
+	// source secret, such as keys stored by other teams, instead of
+	// overwriting the whole target secret.
+	Merge *CopyMerge `json:"merge,omitempty"`
+
+	// Namespace contains the Vault Enterprise namespace of the target secret. It
+	// overrides the namespace of the Vault server specification.
+	Namespace string `json:"namespace,omitempty"`
+
+	// KVVersion is the version (1 or 2) of the KV secrets engine mounted in the
+	// target Vault server. If omitted, the version is detected from the mount.
+	KVVersion int `json:"kv-version,omitempty"`
 
 	// Values is a map of secret keys to CopyValue structures, which define the
 	// source of the secret value. Only one of Values and Secret can be used for
 	// any Copy instance.
-	Values map[string]*CopyValue `json:"values"`
+	Values map[string]*CopyValue `json:"values,omitempty"`
 
 	// Secret is a structure which defines an entire source secret to copy (all of
 	// its keys). Only one of Values and Secret can be used for any Copy instance.
-	Secret *CopyValue `json:"secret"`
+	Secret *CopyValue `json:"secret,omitempty"`
+}
+
+const (
+	// MirrorDeleteSoft deletes the latest version of a target secret, which can
+	// be undeleted, or the secret itself in a KV version 1 secrets engine.
+	MirrorDeleteSoft = "soft"
+
+	// MirrorDeleteMetadata deletes every version and the metadata of a target
+	// secret, or the secret itself in a KV version 1 secrets engine.
+	MirrorDeleteMetadata = "metadata"
+
+	// DefaultMirrorMaxDeletePercent is the default maximum percentage of the
+	// target secrets under a prefix that a mirror can delete.
+	DefaultMirrorMaxDeletePercent = 10
+)
+
+// CopyMirror defines how a Copy instance with a Prefix deletes the target
+// secrets that aren't copied from a source secret.
+type CopyMirror struct {
+	// Delete is how the target secrets are deleted, either MirrorDeleteSoft or
+	// MirrorDeleteMetadata. Defaults to MirrorDeleteSoft.
+	Delete string `json:"delete,omitempty"`
+
+	// MaxDeletePercent is the maximum percentage of the target secrets found
+	// under the prefix that can be deleted. If more would be deleted, the copy
+	// job is aborted before anything is written. Defaults to
+	// DefaultMirrorMaxDeletePercent.
+	MaxDeletePercent int `json:"max-delete-percent,omitempty"`
+}
+
+// Check makes sure that the fields of the receiver have supported values.
+func (p *CopyMirror) Check() error {
+	switch p.Delete {
+	case "", MirrorDeleteSoft, MirrorDeleteMetadata:
+	default:
+		return fmt.Errorf("unsupported mirror delete mode %q, expected %s or %s", p.Delete, MirrorDeleteSoft, MirrorDeleteMetadata)
+	}
+
+	if p.MaxDeletePercent < 0 || p.MaxDeletePercent > 100 {
+		return fmt.Errorf("mirror max-delete-percent must be between 0 (default) and 100, got %d", p.MaxDeletePercent)
+	}
+
+	return nil
+}
+
+// CopyMerge defines how a Copy instance merges the copied keys into its target
+// secret.
+type CopyMerge struct {
+	// RemoveUnmapped removes the keys of the target secret that were copied by
+	// a previous merge but are no longer copied. The copied keys are recorded
+	// in the custom metadata of the target secret, which requires a KV version
+	// 2 target secret.
+	RemoveUnmapped bool `json:"remove-unmapped,omitempty"`
+}
+
+// IsPrefix determines if the receiver copies every secret found under a prefix
+// rather than a single secret.
+func (p *Copy) IsPrefix() bool {
+	return p.Prefix != ""
+}
+
+// targetKey returns a string that identifies the target secret of the
+// receiver, so that copies writing the same target secret can be detected.
+func (p *Copy) targetKey() string {
+	target := p.Path
+	if p.MountPoint != "" {
+		target = p.MountPoint + "/" + p.Path
+	}
+
+	return p.Namespace + "/" + target
+}
+
+// CleanPrefix returns the provided prefix without its leading and trailing
+// slashes. An error is returned if nothing remains, since a prefix designates
+// a path within a KV secrets engine rather than the whole secrets engine.
+func CleanPrefix(prefix string) (string, error) {
+	cleaned := strings.Trim(prefix, "/")
+	if cleaned == "" {
+		return "", errors.New("prefix must designate a path within the KV secrets engine")
+	}
+
+	return cleaned, nil
 }
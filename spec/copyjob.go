@@ -1,11 +1,12 @@
 package spec
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
+	"reflect"
 	"strings"
 )
 
@@ -14,34 +15,156 @@ import (
 type CopyJob struct {
 	// Target is a VaultSpec structure that contains the details to establish an
 	// API Client connection and authenticate with the target Vault server.
-	Target *Vault `json:"target"`
+	Target *Vault `json:"target,omitempty"`
 
 	// Sources is a map of source names to VaultSpec structures.  These VaultSpec
 	// structures contain the details to establish API Client connections to the
 	// source Vault servers needed by this job.
-	Sources map[string]*Vault `json:"sources"`
+	Sources map[string]*Vault `json:"sources,omitempty"`
 
 	// Copies is an array of CopySpec structures that define how each secret
 	// should be copied.
-	Copies []*Copy `json:"copies"`
+	Copies []*Copy `json:"copies,omitempty"`
+
+	// Include is an array of paths of other copy job specification files,
+	// or directories containing them, whose sources and copies are merged
+	// into this one. Relative paths are relative to the directory of the
+	// including file, and glob patterns are supported.
+	Include []string `json:"include,omitempty"`
+}
+
+// LoadOptions is a structure that controls how a copy job specification is
+// loaded.
+type LoadOptions struct {
+	// Format is the format in which the copy job specification is written.
+	Format Format
+
+	// Lenient allows the copy job specification to contain fields that don't
+	// match any field of the CopyJob structure, which are then ignored. By
+	// default, such fields are rejected since they usually are typos.
+	Lenient bool
+
+	// Overlays holds the paths of overlay files, which are applied in order to
+	// the copy job specification once it's loaded. See the ApplyOverlays
+	// function.
+	Overlays []string
+
+	// KeepFileReferences leaves the file references of the copy job
+	// specification as-is instead of replacing them with the contents of the
+	// referenced files.
+	KeepFileReferences bool
 }
 
-// LoadSpec creates a CopyJob structure from the data read from the provided
-// Reader interface.
+// LoadSpec creates a CopyJob structure from the JSON data read from the
+// provided Reader interface.
 func LoadSpec(in io.Reader) (*CopyJob, error) {
+	return LoadSpecOptions(in, LoadOptions{Format: FormatJSON})
+}
+
+// LoadSpecFormat creates a CopyJob structure from the data, written in the
+// provided Format, read from the provided Reader interface.
+func LoadSpecFormat(in io.Reader, format Format) (*CopyJob, error) {
+	return LoadSpecOptions(in, LoadOptions{Format: format})
+}
+
+// LoadSpecOptions creates a CopyJob structure from the data read from the
+// provided Reader interface, as specified by the provided LoadOptions
+// structure. Environment variables are expanded by the ExpandEnv function
+// before the data is decoded, regardless of the Format. Overlays are applied
+// once the data is decoded, then file references are replaced with the
+// contents of the referenced files, while Vault references are left for
+// NewCopyJob to resolve.
+func LoadSpecOptions(in io.Reader, options LoadOptions) (*CopyJob, error) {
+	copyJob, err := decodeSpec(in, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Format only describes the data read from the Reader interface, so
+	// the format of each overlay file is determined by its extension.
+	options.Format = ""
+
+	overlays, err := loadOverlays(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return completeSpec(copyJob, overlays, options)
+}
+
+// decodeSpec creates a CopyJob structure from the data read from the provided
+// Reader interface, like LoadSpecOptions does, but without applying overlays
+// or resolving file references.
+func decodeSpec(in io.Reader, options LoadOptions) (*CopyJob, error) {
 	specBytes, err := ioutil.ReadAll(in)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load spec: %w", err)
 	}
 
-	spec := string(specBytes)
+	spec, err := ExpandEnv(string(specBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	jsonBytes, err := toJSON([]byte(spec), options.Format)
+	if err != nil {
+		return nil, err
+	}
 
-	spec = os.ExpandEnv(spec)
+	if !options.Lenient {
+		if err := checkUnknownFields(jsonBytes, options.Format == FormatJSON); err != nil {
+			return nil, err
+		}
+	}
 
 	var copyJob CopyJob
-	if err := json.NewDecoder(strings.NewReader(spec)).Decode(&copyJob); err != nil {
-		return nil, fmt.Errorf("failed to decode JSON spec: %w", err)
+	if err := json.NewDecoder(bytes.NewReader(jsonBytes)).Decode(&copyJob); err != nil {
+		return nil, fmt.Errorf("failed to decode %s spec: %w", strings.ToUpper(string(options.Format)), err)
 	}
 
 	return &copyJob, nil
 }
+
+// completeSpec applies the provided decoded overlays to the provided decoded
+// CopyJob structure, and then resolves its file references unless the
+// KeepFileReferences field of the provided LoadOptions structure is true.
+func completeSpec(copyJob *CopyJob, overlays []*overlayFile, options LoadOptions) (*CopyJob, error) {
+	copyJob, err := applyOverlayFiles(copyJob, overlays, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.KeepFileReferences {
+		if err := ResolveReferences(copyJob, FileReference, readFileReference); err != nil {
+			return nil, err
+		}
+	}
+
+	return copyJob, nil
+}
+
+// checkUnknownFields returns an error listing the full path of every field of
+// the provided JSON document that doesn't match a field of the CopyJob
+// structure. If withLines is true, the line number of every field is included.
+func checkUnknownFields(data []byte, withLines bool) error {
+	root, err := parseJSONNode(data)
+	if err != nil {
+		// Syntax errors are reported by the decoder.
+		return nil
+	}
+
+	unknownFields := []string{}
+	checkFields(root, reflect.TypeOf(CopyJob{}), jsonPath{}, func(path jsonPath, offset int, message string) {
+		if withLines {
+			unknownFields = append(unknownFields, fmt.Sprintf("%s (line %d)", path, lineOf(data, offset)))
+		} else {
+			unknownFields = append(unknownFields, path.String())
+		}
+	})
+
+	if len(unknownFields) > 0 {
+		return fmt.Errorf("spec contains unknown fields: %s", strings.Join(unknownFields, ", "))
+	}
+
+	return nil
+}
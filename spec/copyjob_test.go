@@ -46,3 +46,25 @@ func TestEnvironmentVariableExpansionLoadSpec(t *testing.T) {
 	assert.Equal(t, "http://target:8200", copyJob.Target.Address)
 	assert.Equal(t, "http://source:8200", copyJob.Sources["s1"].Address)
 }
+
+func TestLoadSpecUnknownFields(t *testing.T) {
+	input := `{
+  "target": {"address": "http://localhost:8200"},
+  "copies": [
+    {"mountpoint": "secret", "path": "p1"}
+  ]
+}`
+
+	copyJob, err := LoadSpec(strings.NewReader(input))
+	assert.EqualError(t, err, "spec contains unknown fields: $.copies[0].mountpoint (line 4)")
+	assert.Nil(t, copyJob)
+
+	copyJob, err = LoadSpecOptions(strings.NewReader(input), LoadOptions{Format: FormatJSON, Lenient: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "p1", copyJob.Copies[0].Path)
+	assert.Equal(t, "", copyJob.Copies[0].MountPoint)
+
+	copyJob, err = LoadSpecFormat(strings.NewReader("copies:\n  - path: p1\n    secret:\n      source: s1\n      keys: k\n"), FormatYAML)
+	assert.EqualError(t, err, "spec contains unknown fields: $.copies[0].secret.keys")
+	assert.Nil(t, copyJob)
+}
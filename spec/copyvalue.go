@@ -4,17 +4,40 @@ package spec
 type CopyValue struct {
 	// Source is the name of the defined Vault structure in the Sources field of
 	// the CopyJob structure.
-	Source string `json:"source"`
+	Source string `json:"source,omitempty"`
 
 	// MountPoint is the path where the KV secrets engine is mounted in the source
 	// Vault server.
-	MountPoint string `json:"mount-point"`
+	MountPoint string `json:"mount-point,omitempty"`
 
 	// Path is the path of the secret being copied within the KV secrets engine in
 	// the source Vault server.
-	Path string `json:"path"`
+	Path string `json:"path,omitempty"`
+
+	// Prefix is the path, within the KV secrets engine in the source Vault
+	// server, under which the secrets to copy are found. It's only used by a
+	// Copy instance with a Prefix, and defaults to the Prefix of that Copy
+	// instance.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Include holds the patterns that select which secrets found under Prefix
+	// are copied, matched against their path relative to Prefix. By default,
+	// every secret is copied. See the CompilePattern function.
+	Include []string `json:"include,omitempty"`
+
+	// Exclude holds the patterns of the secrets found under Prefix that are
+	// not copied, even if they match an Include pattern.
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Namespace contains the Vault Enterprise namespace of the source secret. It
+	// overrides the namespace of the Vault server specification.
+	Namespace string `json:"namespace,omitempty"`
+
+	// KVVersion is the version (1 or 2) of the KV secrets engine mounted in the
+	// source Vault server. If omitted, the version is detected from the mount.
+	KVVersion int `json:"kv-version,omitempty"`
 
 	// Key specifies which value within the secret being copied to copy to the
 	// target Vault server.
-	Key string `json:"key"`
+	Key string `json:"key,omitempty"`
 }
@@ -0,0 +1,178 @@
+package spec
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// variableReference is a reference to an environment variable in a copy job
+// specification, written as ${NAME}, ${NAME:-default}, or ${NAME:?message}.
+type variableReference struct {
+	// Name is the name of the environment variable.
+	Name string
+
+	// Default is the value used when the environment variable is unset or
+	// empty, if HasDefault is true.
+	Default    string
+	HasDefault bool
+
+	// Message is the error message reported when the environment variable is
+	// unset or empty, if Required is true.
+	Message  string
+	Required bool
+}
+
+// expandVariables replaces every environment variable reference in the
+// provided text with the value returned by the provided mapping function for
+// it, and every $$ with a single $. File and Vault references, as well as any
+// other $, are left as-is. An error is returned if a reference is malformed.
+func expandVariables(text string, mapping func(*variableReference) string) (string, error) {
+	builder := strings.Builder{}
+
+	for {
+		index := strings.IndexByte(text, '$')
+		if index < 0 || index == len(text)-1 {
+			builder.WriteString(text)
+			return builder.String(), nil
+		}
+
+		builder.WriteString(text[:index])
+		text = text[index:]
+
+		switch {
+		case strings.HasPrefix(text, "$${") && isReference(text[3:]):
+			// Escaped file and Vault references are unescaped when they're
+			// resolved.
+			builder.WriteString("$$")
+			text = text[2:]
+		case text[1] == '$':
+			builder.WriteByte('$')
+			text = text[2:]
+		case strings.HasPrefix(text, "${") && isReference(text[2:]):
+			// File and Vault references are resolved after decoding.
+			builder.WriteString("${")
+			text = text[2:]
+		case text[1] == '{' && len(text) > 2 && isNameStart(text[2]):
+			end := strings.IndexByte(text, '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated variable reference %q", text)
+			}
+
+			reference, err := parseVariableReference(text[2:end])
+			if err != nil {
+				return "", err
+			}
+
+			builder.WriteString(mapping(reference))
+			text = text[end+1:]
+		default:
+			builder.WriteByte('$')
+			text = text[1:]
+		}
+	}
+}
+
+// parseVariableReference parses the provided contents of a ${...} reference.
+func parseVariableReference(contents string) (*variableReference, error) {
+	nameEnd := 0
+	for nameEnd < len(contents) && isNameChar(contents[nameEnd]) {
+		nameEnd++
+	}
+
+	reference := &variableReference{Name: contents[:nameEnd]}
+	operator := contents[nameEnd:]
+
+	switch {
+	case operator == "":
+	case strings.HasPrefix(operator, ":-"):
+		reference.Default = operator[2:]
+		reference.HasDefault = true
+	case strings.HasPrefix(operator, ":?"):
+		reference.Message = operator[2:]
+		reference.Required = true
+	default:
+		return nil, fmt.Errorf("invalid variable reference ${%s}", contents)
+	}
+
+	return reference, nil
+}
+
+// isNameStart determines if the provided character can start the name of an
+// environment variable.
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+// isNameChar determines if the provided character can be part of the name of
+// an environment variable.
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// ExpandEnv replaces every environment variable reference in the provided
+// text with the value of the environment variable. A reference written as
+// ${NAME:-default} is replaced with the default value if the environment
+// variable is unset or empty, and $$ is replaced with a single $. An error
+// listing every problem is returned if any environment variable without a
+// default value is unset, or if a required environment variable, written as
+// ${NAME:?message}, is unset or empty.
+func ExpandEnv(text string) (string, error) {
+	problems := []string{}
+	reported := make(map[string]bool)
+
+	expanded, err := expandVariables(text, func(reference *variableReference) string {
+		value, problem := resolveVariable(reference)
+		if problem != "" && !reported[problem] {
+			reported[problem] = true
+			problems = append(problems, problem)
+		}
+
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(problems) > 0 {
+		return "", fmt.Errorf("failed to expand environment variables: %s", strings.Join(problems, "; "))
+	}
+
+	return expanded, nil
+}
+
+// resolveVariable returns the value of the provided environment variable
+// reference, or a description of the problem if it can't be resolved.
+func resolveVariable(reference *variableReference) (string, string) {
+	value, found := os.LookupEnv(reference.Name)
+
+	switch {
+	case value != "":
+		return value, ""
+	case reference.HasDefault:
+		return reference.Default, ""
+	case reference.Required && reference.Message != "":
+		return "", fmt.Sprintf("%s: %s", reference.Name, reference.Message)
+	case reference.Required:
+		return "", fmt.Sprintf("%s is required", reference.Name)
+	case !found:
+		return "", fmt.Sprintf("%s is not set", reference.Name)
+	default:
+		return "", ""
+	}
+}
+
+// expandLeniently expands the environment variable references of the provided
+// text like ExpandEnv does, but ignores the problems it finds, which are
+// reported separately.
+func expandLeniently(text string) string {
+	expanded, err := expandVariables(text, func(reference *variableReference) string {
+		value, _ := resolveVariable(reference)
+		return value
+	})
+	if err != nil {
+		return text
+	}
+
+	return expanded
+}
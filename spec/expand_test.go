@@ -0,0 +1,68 @@
+package spec
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("HVC_EXPAND_SET", "value")
+	os.Setenv("HVC_EXPAND_EMPTY", "")
+	os.Unsetenv("HVC_EXPAND_UNSET")
+	os.Unsetenv("HVC_EXPAND_OTHER")
+	defer os.Unsetenv("HVC_EXPAND_SET")
+	defer os.Unsetenv("HVC_EXPAND_EMPTY")
+
+	for _, testcase := range []struct {
+		input         string
+		expected      string
+		expectedError string
+	}{
+		{input: "${HVC_EXPAND_SET}", expected: "value"},
+		{input: "a${HVC_EXPAND_SET}b${HVC_EXPAND_SET}", expected: "avaluebvalue"},
+		{input: "${HVC_EXPAND_EMPTY}", expected: ""},
+		{input: "${HVC_EXPAND_UNSET:-default}", expected: "default"},
+		{input: "${HVC_EXPAND_EMPTY:-default}", expected: "default"},
+		{input: "${HVC_EXPAND_SET:-default}", expected: "value"},
+		{input: "${HVC_EXPAND_SET:?must be set}", expected: "value"},
+		// Literal dollar signs are left as-is
+		{input: "pa$word", expected: "pa$word"},
+		{input: "$HVC_EXPAND_SET", expected: "$HVC_EXPAND_SET"},
+		{input: "cost: 5$", expected: "cost: 5$"},
+		{input: "${1}", expected: "${1}"},
+		// Escaped dollar signs
+		{input: "pa$$word", expected: "pa$word"},
+		{input: "$${HVC_EXPAND_SET}", expected: "${HVC_EXPAND_SET}"},
+		// Errors
+		{
+			input:         "${HVC_EXPAND_UNSET} ${HVC_EXPAND_OTHER} ${HVC_EXPAND_UNSET}",
+			expectedError: "failed to expand environment variables: HVC_EXPAND_UNSET is not set; HVC_EXPAND_OTHER is not set",
+		},
+		{
+			input:         "${HVC_EXPAND_EMPTY:?the token is required}",
+			expectedError: "failed to expand environment variables: HVC_EXPAND_EMPTY: the token is required",
+		},
+		{
+			input:         "${HVC_EXPAND_UNSET:?}",
+			expectedError: "failed to expand environment variables: HVC_EXPAND_UNSET is required",
+		},
+		{
+			input:         "${HVC_EXPAND_SET",
+			expectedError: `unterminated variable reference "${HVC_EXPAND_SET"`,
+		},
+		{
+			input:         "${HVC_EXPAND_SET:=value}",
+			expectedError: "invalid variable reference ${HVC_EXPAND_SET:=value}",
+		},
+	} {
+		expanded, err := ExpandEnv(testcase.input)
+		if testcase.expectedError != "" {
+			assert.EqualError(t, err, testcase.expectedError, testcase.input)
+		} else {
+			assert.NoError(t, err, testcase.input)
+			assert.Equal(t, testcase.expected, expanded, testcase.input)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"sigs.k8s.io/yaml"
+)
+
+// Format identifies the language in which a copy job specification is
+// written.
+type Format string
+
+const (
+	// FormatJSON identifies a copy job specification written in JSON.
+	FormatJSON Format = "json"
+
+	// FormatYAML identifies a copy job specification written in YAML.
+	FormatYAML Format = "yaml"
+
+	// FormatHCL identifies a copy job specification written in HCL.
+	FormatHCL Format = "hcl"
+)
+
+// ParseFormat returns the Format with the provided name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case FormatJSON, FormatYAML, FormatHCL:
+		return format, nil
+	case "yml":
+		return FormatYAML, nil
+	default:
+		return "", fmt.Errorf("unsupported copy job specification format %q", name)
+	}
+}
+
+// FormatOf returns the Format of a copy job specification file based on the
+// extension of the provided filename. Files with the .yaml or .yml extension
+// are YAML, files with the .hcl extension are HCL, and every other file is
+// JSON.
+func FormatOf(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".hcl":
+		return FormatHCL
+	default:
+		return FormatJSON
+	}
+}
+
+// toJSON converts the provided copy job specification document, written in
+// the provided Format, into a JSON document.
+func toJSON(data []byte, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON, "":
+		return data, nil
+	case FormatYAML:
+		jsonBytes, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode YAML spec: %w", err)
+		}
+
+		return jsonBytes, nil
+	case FormatHCL:
+		var document interface{}
+		if err := hcl.Unmarshal(data, &document); err != nil {
+			return nil, fmt.Errorf("failed to decode HCL spec: %w", err)
+		}
+
+		jsonBytes, err := json.Marshal(normalizeHCL(document, reflect.TypeOf(CopyJob{})))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert HCL spec: %w", err)
+		}
+
+		return jsonBytes, nil
+	default:
+		return nil, fmt.Errorf("unsupported copy job specification format %q", format)
+	}
+}
+
+// normalizeHCL reshapes the provided value, decoded from an HCL document, to
+// match the provided type. HCL decodes every block as a list of objects, so
+// the lists found where a single object is expected are merged into one
+// object.
+func normalizeHCL(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := hclObject(value)
+		if !ok {
+			return value
+		}
+
+		fields := jsonFields(t)
+		for key, member := range object {
+			if field, found := fields[key]; found {
+				object[key] = normalizeHCL(member, field)
+			}
+		}
+
+		return object
+	case reflect.Map:
+		object, ok := hclObject(value)
+		if !ok {
+			return value
+		}
+
+		for key, member := range object {
+			object[key] = normalizeHCL(member, t.Elem())
+		}
+
+		return object
+	case reflect.Slice:
+		switch list := value.(type) {
+		case []map[string]interface{}:
+			elements := make([]interface{}, len(list))
+			for i, element := range list {
+				elements[i] = normalizeHCL(element, t.Elem())
+			}
+
+			return elements
+		case []interface{}:
+			for i, element := range list {
+				list[i] = normalizeHCL(element, t.Elem())
+			}
+
+			return list
+		}
+	}
+
+	return value
+}
+
+// hclObject returns the provided value as a single object, merging the
+// objects of a list produced by HCL blocks.
+func hclObject(value interface{}) (map[string]interface{}, bool) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return value, true
+	case []map[string]interface{}:
+		object := make(map[string]interface{})
+		for _, element := range value {
+			for key, member := range element {
+				object[key] = member
+			}
+		}
+
+		return object, true
+	case []interface{}:
+		object := make(map[string]interface{})
+		for _, element := range value {
+			elementObject, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+
+			for key, member := range elementObject {
+				object[key] = member
+			}
+		}
+
+		return object, true
+	default:
+		return nil, false
+	}
+}
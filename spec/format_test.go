@@ -0,0 +1,126 @@
+package spec
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatOf(t *testing.T) {
+	assert.Equal(t, FormatJSON, FormatOf("spec.json"))
+	assert.Equal(t, FormatJSON, FormatOf("spec"))
+	assert.Equal(t, FormatYAML, FormatOf("spec.yaml"))
+	assert.Equal(t, FormatYAML, FormatOf("dir/spec.YML"))
+	assert.Equal(t, FormatHCL, FormatOf("spec.hcl"))
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{"json": FormatJSON, "YAML": FormatYAML, "yml": FormatYAML, "hcl": FormatHCL} {
+		format, err := ParseFormat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+
+	_, err := ParseFormat("toml")
+	assert.Error(t, err)
+}
+
+func TestLoadSpecFormat(t *testing.T) {
+	os.Setenv("TARGET_VAULT_ADDR", "http://target:8200")
+	defer os.Unsetenv("TARGET_VAULT_ADDR")
+
+	expected := &CopyJob{
+		Target: &Vault{Address: "http://target:8200"},
+		Sources: map[string]*Vault{
+			"s1": {Address: "http://source:8200", Login: &VaultLogin{Token: "t1"}},
+		},
+		Copies: []*Copy{
+			{Path: "p1", KVVersion: 2, Secret: &CopyValue{Source: "s1"}},
+			{Path: "p2", Values: map[string]*CopyValue{"k1": {Source: "s1", Key: "k"}}},
+		},
+	}
+
+	for _, testcase := range []struct {
+		format Format
+		input  string
+	}{
+		{
+			format: FormatYAML,
+			input: `
+target:
+  address: ${TARGET_VAULT_ADDR}
+sources:
+  s1:
+    address: http://source:8200
+    login:
+      token: t1
+copies:
+  - path: p1
+    kv-version: 2
+    secret:
+      source: s1
+  - path: p2
+    values:
+      k1:
+        source: s1
+        key: k
+`,
+		},
+		{
+			format: FormatHCL,
+			input: `
+target {
+  address = "${TARGET_VAULT_ADDR}"
+}
+
+sources "s1" {
+  address = "http://source:8200"
+
+  login {
+    token = "t1"
+  }
+}
+
+copies {
+  path       = "p1"
+  kv-version = 2
+
+  secret {
+    source = "s1"
+  }
+}
+
+copies {
+  path = "p2"
+
+  values "k1" {
+    source = "s1"
+    key    = "k"
+  }
+}
+`,
+		},
+	} {
+		copyJob, err := LoadSpecFormat(strings.NewReader(testcase.input), testcase.format)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, copyJob)
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	validationErrors := ValidateFormat([]byte(`
+target:
+  adress: http://target:8200
+copies:
+  - secret:
+      source: s1
+`), FormatYAML)
+
+	assert.Equal(t, []*ValidationError{
+		{Path: "$.target.adress", Message: `unknown field "adress"`},
+		{Path: "$.copies[0].path", Message: "copy element must provide a target secret path"},
+		{Path: "$.copies[0].secret.source", Message: `source Vault "s1" is not defined in sources`},
+	}, validationErrors)
+}
@@ -0,0 +1,326 @@
+package spec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadSpecFiles loads the copy job specification files at the provided paths,
+// along with the files they include, and merges them into a single CopyJob
+// structure. A path can also designate a directory, in which case every file
+// of the directory with a .json, .yaml, .yml, or .hcl extension is loaded, in
+// lexical order. Each file is loaded at most once. The sources of the files
+// are merged and their copies are concatenated, and an error is returned if
+// more than one file defines the target, or if a source name is defined more
+// than once. When the Format field of the provided LoadOptions structure is
+// empty, the format of each file is determined by its extension. The overlays
+// of the provided LoadOptions structure are applied to the merged CopyJob
+// structure, and an error is returned if more than one of the resulting copies
+// writes the same target secret, as spelled by their paths. A LoadedFiles
+// structure describing every loaded file and overlay is returned along with
+// the CopyJob structure, whose Include field is left empty since the included
+// files are already merged into it.
+func LoadSpecFiles(paths []string, options LoadOptions) (*CopyJob, *LoadedFiles, error) {
+	documents, err := collectSpecFiles(paths, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := &CopyJob{
+		Sources: make(map[string]*Vault),
+		Copies:  []*Copy{},
+	}
+
+	targetFile := ""
+	sourceFiles := make(map[string]string)
+	copyOrigins := []string{}
+
+	for _, document := range documents {
+		copyJob, err := loadSpecFile(document, options)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		file := document.file
+
+		if copyJob.Target != nil {
+			if targetFile != "" {
+				return nil, nil, fmt.Errorf("target is defined in both %s and %s", targetFile, file)
+			}
+
+			merged.Target = copyJob.Target
+			targetFile = file
+		}
+
+		for name, source := range copyJob.Sources {
+			if sourceFile, found := sourceFiles[name]; found {
+				return nil, nil, fmt.Errorf("source %q is defined in both %s and %s", name, sourceFile, file)
+			}
+
+			merged.Sources[name] = source
+			sourceFiles[name] = file
+		}
+
+		for i, copy := range copyJob.Copies {
+			copyOrigins = append(copyOrigins, fmt.Sprintf("%s of %s", jsonPath{"copies", i}, file))
+			merged.Copies = append(merged.Copies, copy)
+		}
+	}
+
+	overlays, err := loadOverlays(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged, err = completeSpec(merged, overlays, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkDuplicateTargets(merged.Copies, copyOrigins); err != nil {
+		return nil, nil, err
+	}
+
+	loadedFiles := &LoadedFiles{}
+	digest := sha256.New()
+
+	for _, document := range documents {
+		if err := loadedFiles.add(digest, document.file, document.data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, overlay := range overlays {
+		if err := loadedFiles.add(digest, overlay.path, overlay.contents); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	loadedFiles.Digest = hex.EncodeToString(digest.Sum(nil))
+
+	return merged, loadedFiles, nil
+}
+
+// LoadedFiles is a structure that describes the files loaded by LoadSpecFiles.
+type LoadedFiles struct {
+	// Paths holds the paths of every loaded copy job specification file,
+	// followed by the paths of the overlays.
+	Paths []string
+
+	// Digest is the hex-encoded SHA-256 hash of the absolute paths and
+	// contents of the loaded files, as they were read when loading them.
+	Digest string
+}
+
+// add adds the file at the provided path, whose contents were read, to the
+// receiver and to the provided digest.
+func (p *LoadedFiles) add(digest hash.Hash, path string, contents []byte) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to determine path of file %s: %w", path, err)
+	}
+
+	p.Paths = append(p.Paths, path)
+
+	fmt.Fprintf(digest, "%s\x00%d\x00", absPath, len(contents))
+	digest.Write(contents)
+
+	return nil
+}
+
+// checkDuplicateTargets returns an error if more than one of the provided
+// copies writes the same target secret. The provided origins describe where
+// each copy was loaded from, and the copies beyond them were added by
+// overlays. Target secrets are compared as spelled, so a copy with the kv
+// mount point and the a path isn't a duplicate of a copy with the kv/a path.
+func checkDuplicateTargets(copies []*Copy, origins []string) error {
+	firstOrigins := make(map[string]string)
+
+	for i, copy := range copies {
+		if copy == nil || copy.Path == "" {
+			continue
+		}
+
+		origin := fmt.Sprintf("%s of the overlays", jsonPath{"copies", i})
+		if i < len(origins) {
+			origin = origins[i]
+		}
+
+		if firstOrigin, found := firstOrigins[copy.targetKey()]; found {
+			return fmt.Errorf("%s and %s write the same target secret", firstOrigin, origin)
+		}
+
+		firstOrigins[copy.targetKey()] = origin
+	}
+
+	return nil
+}
+
+// loadSpecFile decodes the provided copy job specification document, leaving
+// the overlays and file references for LoadSpecFiles to handle once every file
+// is merged.
+func loadSpecFile(document *specDocument, options LoadOptions) (*CopyJob, error) {
+	options.Format = document.format
+
+	copyJob, err := decodeSpec(bytes.NewReader(document.data), options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load copy job specification file %s: %w", document.file, err)
+	}
+
+	return copyJob, nil
+}
+
+// formatFor returns the Format of the copy job specification file at the
+// provided path, which is the Format of the provided LoadOptions structure if
+// it's set.
+func formatFor(path string, options LoadOptions) Format {
+	if options.Format != "" {
+		return options.Format
+	}
+
+	return FormatOf(path)
+}
+
+// collectSpecFiles reads the copy job specification files designated by the
+// provided paths, followed by the files they include, without duplicates, and
+// returns them as documents.
+func collectSpecFiles(paths []string, options LoadOptions) ([]*specDocument, error) {
+	collector := &specFileCollector{
+		options: options,
+		seen:    make(map[string]bool),
+	}
+
+	for _, path := range paths {
+		if err := collector.addPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return collector.documents, nil
+}
+
+// specFileCollector is a structure that accumulates copy job specification
+// documents.
+type specFileCollector struct {
+	options   LoadOptions
+	documents []*specDocument
+	seen      map[string]bool
+}
+
+// addPath adds the copy job specification file at the provided path, or every
+// copy job specification file of the directory at the provided path.
+func (p *specFileCollector) addPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to open copy job specification file %s: %w", path, err)
+	}
+
+	if !info.IsDir() {
+		return p.addFile(path)
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("failed to read copy job specification directory %s: %w", path, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isSpecFile(entry.Name()) {
+			continue
+		}
+
+		if err := p.addFile(filepath.Join(path, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addFile adds the copy job specification file at the provided path, followed
+// by the files it includes, unless it was already added.
+func (p *specFileCollector) addFile(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to determine path of copy job specification file %s: %w", path, err)
+	}
+
+	if p.seen[absPath] {
+		return nil
+	}
+
+	p.seen[absPath] = true
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read copy job specification file %s: %w", path, err)
+	}
+
+	document := &specDocument{file: path, data: data, format: formatFor(path, p.options)}
+	p.documents = append(p.documents, document)
+
+	includes := readIncludes(document)
+
+	for _, include := range includes {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include %q in %s: %w", include, path, err)
+		}
+
+		if len(matches) == 0 {
+			return fmt.Errorf("include %q in %s matches no file", include, path)
+		}
+
+		for _, match := range matches {
+			if err := p.addPath(match); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readIncludes returns the include paths of the provided copy job
+// specification document. Problems are left for the loading of the document to
+// report.
+func readIncludes(document *specDocument) []string {
+	jsonBytes, err := toJSON([]byte(expandLeniently(string(document.data))), document.format)
+	if err != nil {
+		return nil
+	}
+
+	var header struct {
+		Include []string `json:"include"`
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(jsonBytes)).Decode(&header); err != nil {
+		return nil
+	}
+
+	return header.Include
+}
+
+// isSpecFile determines if the provided filename has the extension of a copy
+// job specification file.
+func isSpecFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".yaml", ".yml", ".hcl":
+		return true
+	default:
+		return false
+	}
+}
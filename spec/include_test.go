@@ -0,0 +1,210 @@
+package spec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSpecFiles writes the provided copy job specification files, keyed by
+// their paths relative to the provided directory.
+func writeSpecFiles(t *testing.T, directory string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(directory, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	}
+}
+
+func TestLoadSpecFilesDirectory(t *testing.T) {
+	directory := t.TempDir()
+	writeSpecFiles(t, directory, map[string]string{
+		"10-target.json":  `{"target": {"address": "http://target:8200"}}`,
+		"20-sources.yaml": "sources:\n  s1:\n    address: http://source:8200\n",
+		"30-copies.json":  `{"copies": [{"path": "p1", "secret": {"source": "s1"}}]}`,
+		"README.md":       "not a copy job specification",
+		"nested/40.json":  `{"copies": [{"path": "p2"}]}`,
+	})
+
+	copyJob, files, err := LoadSpecFiles([]string{directory}, LoadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(directory, "10-target.json"),
+		filepath.Join(directory, "20-sources.yaml"),
+		filepath.Join(directory, "30-copies.json"),
+	}, files.Paths)
+	assert.Equal(t, "http://target:8200", copyJob.Target.Address)
+	assert.Equal(t, "http://source:8200", copyJob.Sources["s1"].Address)
+	assert.Len(t, copyJob.Copies, 1)
+	assert.Equal(t, "p1", copyJob.Copies[0].Path)
+}
+
+func TestLoadSpecFilesInclude(t *testing.T) {
+	directory := t.TempDir()
+	writeSpecFiles(t, directory, map[string]string{
+		"main.json":         `{"include": ["common/*.json", "team.hcl"], "target": {"address": "http://target:8200"}}`,
+		"common/a.json":     `{"include": ["../main.json"], "sources": {"s1": {"address": "http://source:8200"}}}`,
+		"common/b.json":     `{"copies": [{"path": "b"}]}`,
+		"team.hcl":          "copies {\n  path = \"team\"\n}\n",
+		"common/ignored.md": "",
+	})
+
+	copyJob, files, err := LoadSpecFiles([]string{filepath.Join(directory, "main.json")}, LoadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(directory, "main.json"),
+		filepath.Join(directory, "common", "a.json"),
+		filepath.Join(directory, "common", "b.json"),
+		filepath.Join(directory, "team.hcl"),
+	}, files.Paths)
+	assert.Len(t, copyJob.Sources, 1)
+	if assert.Len(t, copyJob.Copies, 2) {
+		assert.Equal(t, "b", copyJob.Copies[0].Path)
+		assert.Equal(t, "team", copyJob.Copies[1].Path)
+	}
+
+	writeSpecFiles(t, directory, map[string]string{
+		"missing.json": `{"include": ["nothing-*.json"]}`,
+	})
+
+	_, _, err = LoadSpecFiles([]string{filepath.Join(directory, "missing.json")}, LoadOptions{})
+	assert.EqualError(t, err, fmt.Sprintf(`include "nothing-*.json" in %s matches no file`, filepath.Join(directory, "missing.json")))
+}
+
+func TestLoadSpecFilesConflicts(t *testing.T) {
+	for _, testcase := range []struct {
+		files         map[string]string
+		expectedError string
+	}{
+		{
+			files: map[string]string{
+				"a.json": `{"target": {"address": "http://target1:8200"}}`,
+				"b.json": `{"target": {"address": "http://target2:8200"}}`,
+			},
+			expectedError: "target is defined in both {{a.json}} and {{b.json}}",
+		},
+		{
+			files: map[string]string{
+				"a.json": `{"sources": {"s1": {"address": "http://source1:8200"}}}`,
+				"b.json": `{"sources": {"s1": {"address": "http://source2:8200"}}}`,
+			},
+			expectedError: `source "s1" is defined in both {{a.json}} and {{b.json}}`,
+		},
+		{
+			files: map[string]string{
+				"a.json": `{"copies": [{"mount-point": "secret", "path": "p1"}]}`,
+				"b.json": `{"copies": [{"path": "p2"}, {"mount-point": "secret", "path": "p1"}]}`,
+			},
+			expectedError: "$.copies[0] of {{a.json}} and $.copies[1] of {{b.json}} write the same target secret",
+		},
+	} {
+		directory := t.TempDir()
+		writeSpecFiles(t, directory, testcase.files)
+
+		expectedError := testcase.expectedError
+		for name := range testcase.files {
+			expectedError = strings.ReplaceAll(expectedError, "{{"+name+"}}", filepath.Join(directory, name))
+		}
+
+		_, _, err := LoadSpecFiles([]string{directory}, LoadOptions{})
+		assert.EqualError(t, err, expectedError)
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	directory := t.TempDir()
+	writeSpecFiles(t, directory, map[string]string{
+		"a.json": `{
+  "target": {"address": "http://target1:8200"},
+  "sources": {"s1": {"address": "http://source:8200"}},
+  "copies": [{"path": "p1", "secret": {"source": "s1"}}]
+}`,
+		"b.json": `{
+  "target": {"address": "http://target2:8200"},
+  "copies": [
+    {"path": "p1", "secret": {"source": "s2"}}
+  ]
+}`,
+	})
+
+	validationErrors := ValidateFiles([]string{directory}, LoadOptions{})
+	bFile := filepath.Join(directory, "b.json")
+	assert.Equal(t, []*ValidationError{
+		{File: bFile, Path: "$.target", Line: 2, Message: "target is already defined in " + filepath.Join(directory, "a.json")},
+		{File: bFile, Path: "$.copies[0].secret.source", Line: 4, Message: `source Vault "s2" is not defined in sources`},
+		{File: bFile, Path: "$.copies[0].path", Line: 4, Message: "target secret is already written by $.copies[0] of " + filepath.Join(directory, "a.json")},
+	}, validationErrors)
+}
+
+func TestLoadSpecFilesOverlayConflicts(t *testing.T) {
+	for _, testcase := range []struct {
+		overlay       string
+		expectedError string
+	}{
+		// The overlay adds a copy of an existing target secret.
+		{
+			overlay:       `{"copies": [{"mount-point": "secret", "path": "p1"}]}`,
+			expectedError: "$.copies[0] of {{a.json}} and $.copies[2] of the overlays write the same target secret",
+		},
+		// The overlay retargets a copy to an existing target secret.
+		{
+			overlay:       `{"copies": [{"id": "second", "path": "p1"}]}`,
+			expectedError: "$.copies[0] of {{a.json}} and $.copies[0] of {{b.json}} write the same target secret",
+		},
+	} {
+		directory := t.TempDir()
+		writeSpecFiles(t, directory, map[string]string{
+			"specs/a.json": `{"copies": [{"mount-point": "secret", "path": "p1"}]}`,
+			"specs/b.json": `{"copies": [{"id": "second", "mount-point": "secret", "path": "p2"}]}`,
+			"overlay.json": testcase.overlay,
+		})
+
+		expectedError := testcase.expectedError
+		for _, name := range []string{"a.json", "b.json"} {
+			expectedError = strings.ReplaceAll(expectedError, "{{"+name+"}}", filepath.Join(directory, "specs", name))
+		}
+
+		_, _, err := LoadSpecFiles([]string{filepath.Join(directory, "specs")}, LoadOptions{Overlays: []string{filepath.Join(directory, "overlay.json")}})
+		assert.EqualError(t, err, expectedError)
+	}
+}
+
+func TestLoadSpecFilesDigest(t *testing.T) {
+	directory := t.TempDir()
+	writeSpecFiles(t, directory, map[string]string{
+		"main.json":    `{"include": ["copies.json"], "target": {"address": "http://target:8200"}}`,
+		"copies.json":  `{"copies": [{"path": "p1", "values": {"k1": {"source": "s1"}}}]}`,
+		"overlay.json": `{"target": {"address": "https://target:8200"}}`,
+	})
+
+	paths := []string{filepath.Join(directory, "main.json")}
+	options := LoadOptions{Overlays: []string{filepath.Join(directory, "overlay.json")}}
+
+	_, files, err := LoadSpecFiles(paths, options)
+	assert.NoError(t, err)
+	assert.Len(t, files.Digest, 64)
+
+	_, unchanged, err := LoadSpecFiles(paths, options)
+	assert.NoError(t, err)
+	assert.Equal(t, files.Digest, unchanged.Digest)
+
+	// Changing an included file or an overlay changes the digest.
+	digests := map[string]bool{files.Digest: true}
+	for name, contents := range map[string]string{
+		"copies.json":  `{"copies": [{"path": "p2", "values": {"k1": {"source": "s1"}}}]}`,
+		"overlay.json": `{"target": {"address": "https://target.prod:8200"}}`,
+	} {
+		writeSpecFiles(t, directory, map[string]string{name: contents})
+
+		_, changed, err := LoadSpecFiles(paths, options)
+		assert.NoError(t, err)
+		assert.False(t, digests[changed.Digest], name)
+
+		digests[changed.Digest] = true
+	}
+}
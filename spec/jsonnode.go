@@ -0,0 +1,325 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// jsonNode is a JSON value decoded along with its position in the document,
+// so that problems can be reported with a line number.
+type jsonNode struct {
+	// offset is the byte offset at which the value starts in the document.
+	offset int
+
+	// members holds the members of an object value, in document order.
+	members []*jsonMember
+
+	// elements holds the elements of an array value.
+	elements []*jsonNode
+
+	// value holds a scalar value: a string, a json.Number, a bool, or nil.
+	value interface{}
+
+	// kind is '{' for an object, '[' for an array, or 0 for a scalar.
+	kind rune
+}
+
+// jsonMember is a member of a JSON object.
+type jsonMember struct {
+	key    string
+	offset int
+	value  *jsonNode
+}
+
+// parseJSONNode decodes the provided JSON document into a tree of jsonNode
+// structures.
+func parseJSONNode(data []byte) (*jsonNode, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	node, err := decodeJSONNode(decoder, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err == nil {
+		return nil, fmt.Errorf("unexpected data after the top-level value at line %d", lineOf(data, int(decoder.InputOffset())))
+	}
+
+	return node, nil
+}
+
+// decodeJSONNode decodes the next value of the provided Decoder.
+func decodeJSONNode(decoder *json.Decoder, data []byte) (*jsonNode, error) {
+	offset := skipSeparators(data, int(decoder.InputOffset()))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, syntaxError(data, err)
+	}
+
+	node := &jsonNode{offset: offset}
+
+	switch token {
+	case json.Delim('{'):
+		node.kind = '{'
+		for decoder.More() {
+			keyOffset := skipSeparators(data, int(decoder.InputOffset()))
+
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, syntaxError(data, err)
+			}
+
+			value, err := decodeJSONNode(decoder, data)
+			if err != nil {
+				return nil, err
+			}
+
+			node.members = append(node.members, &jsonMember{
+				key:    keyToken.(string),
+				offset: keyOffset,
+				value:  value,
+			})
+		}
+
+		if _, err := decoder.Token(); err != nil {
+			return nil, syntaxError(data, err)
+		}
+	case json.Delim('['):
+		node.kind = '['
+		for decoder.More() {
+			element, err := decodeJSONNode(decoder, data)
+			if err != nil {
+				return nil, err
+			}
+
+			node.elements = append(node.elements, element)
+		}
+
+		if _, err := decoder.Token(); err != nil {
+			return nil, syntaxError(data, err)
+		}
+	default:
+		node.value = token
+	}
+
+	return node, nil
+}
+
+// member returns the value of the member of the receiver with the provided
+// key, or nil if the receiver isn't an object or has no such member.
+func (p *jsonNode) member(key string) *jsonNode {
+	if p == nil {
+		return nil
+	}
+
+	for _, member := range p.members {
+		if member.key == key {
+			return member.value
+		}
+	}
+
+	return nil
+}
+
+// element returns the element of the receiver at the provided index, or nil
+// if the receiver isn't an array or has no such element.
+func (p *jsonNode) element(index int) *jsonNode {
+	if p == nil || index < 0 || index >= len(p.elements) {
+		return nil
+	}
+
+	return p.elements[index]
+}
+
+// at returns the node of the receiver's tree at the provided path, or nil if
+// there is none.
+func (p *jsonNode) at(path jsonPath) *jsonNode {
+	node := p
+	for _, segment := range path {
+		switch segment := segment.(type) {
+		case string:
+			node = node.member(segment)
+		case int:
+			node = node.element(segment)
+		}
+	}
+
+	return node
+}
+
+// lookup returns the offset of the deepest node of the receiver's tree along
+// the provided path, so that a problem with a missing member is reported at
+// its parent.
+func (p *jsonNode) lookup(path jsonPath) int {
+	node := p
+	for _, segment := range path {
+		var next *jsonNode
+		switch segment := segment.(type) {
+		case string:
+			next = node.member(segment)
+		case int:
+			next = node.element(segment)
+		}
+
+		if next == nil {
+			break
+		}
+
+		node = next
+	}
+
+	return node.offset
+}
+
+// jsonPath is a path within a JSON document made of object keys (strings)
+// and array indices (ints).
+type jsonPath []interface{}
+
+// hasPrefix determines if the receiver starts with the segments of the
+// provided path.
+func (p jsonPath) hasPrefix(prefix jsonPath) bool {
+	if len(prefix) > len(p) {
+		return false
+	}
+
+	for i, segment := range prefix {
+		if p[i] != segment {
+			return false
+		}
+	}
+
+	return true
+}
+
+// with returns a copy of the receiver extended with the provided segments.
+func (p jsonPath) with(segments ...interface{}) jsonPath {
+	path := make(jsonPath, 0, len(p)+len(segments))
+	path = append(path, p...)
+
+	return append(path, segments...)
+}
+
+// identifierPattern matches the object keys that can be written in dot
+// notation in a JSON path.
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// String formats the receiver as a JSON path, such as $.copies[0].path.
+func (p jsonPath) String() string {
+	builder := strings.Builder{}
+	builder.WriteString("$")
+
+	for _, segment := range p {
+		switch segment := segment.(type) {
+		case int:
+			fmt.Fprintf(&builder, "[%d]", segment)
+		case string:
+			if identifierPattern.MatchString(segment) {
+				fmt.Fprintf(&builder, ".%s", segment)
+			} else {
+				fmt.Fprintf(&builder, "[%q]", segment)
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// checkFields reports every member of the provided node, and of its
+// descendants, that doesn't match a field of the provided type, which is the
+// type the node is decoded into.
+func checkFields(node *jsonNode, t reflect.Type, path jsonPath, report func(jsonPath, int, string)) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && node.kind == '{':
+		fields := jsonFields(t)
+
+		for _, member := range node.members {
+			field, found := fields[member.key]
+			if !found {
+				report(path.with(member.key), member.offset, fmt.Sprintf("unknown field %q", member.key))
+				continue
+			}
+
+			checkFields(member.value, field, path.with(member.key), report)
+		}
+	case t.Kind() == reflect.Map && node.kind == '{':
+		for _, member := range node.members {
+			checkFields(member.value, t.Elem(), path.with(member.key), report)
+		}
+	case t.Kind() == reflect.Slice && node.kind == '[':
+		for i, element := range node.elements {
+			checkFields(element, t.Elem(), path.with(i), report)
+		}
+	}
+}
+
+// jsonFields maps the JSON names of the fields of the provided struct type to
+// their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields[name] = field.Type
+	}
+
+	return fields
+}
+
+// skipSeparators returns the offset of the first byte at or after the provided
+// offset that isn't whitespace or a separator between JSON tokens.
+func skipSeparators(data []byte, offset int) int {
+	for offset < len(data) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+
+	return offset
+}
+
+// lineOf returns the line number of the provided byte offset in the provided
+// document.
+func lineOf(data []byte, offset int) int {
+	if offset > len(data) {
+		offset = len(data)
+	}
+
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// syntaxError adds the line number to the provided JSON decoding error.
+func syntaxError(data []byte, err error) error {
+	if err == io.EOF {
+		return errors.New("unexpected end of JSON input")
+	}
+
+	var jsonSyntaxError *json.SyntaxError
+	if errors.As(err, &jsonSyntaxError) {
+		return fmt.Errorf("line %d: %w", lineOf(data, int(jsonSyntaxError.Offset)), err)
+	}
+
+	return err
+}
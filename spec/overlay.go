@@ -0,0 +1,284 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// ApplyOverlays applies the overlay files at the provided paths, in order, to
+// the provided CopyJob structure and returns the resulting CopyJob structure.
+// An overlay file is a partial copy job specification, loaded as specified by
+// the provided LoadOptions structure, whose fields replace those of the copy
+// job specification. Objects are merged recursively and a null value removes
+// the field. The copies of an overlay are matched by their ID with the copies
+// of the copy job specification, which they are merged into, and the copies
+// that match none are appended. The provided CopyJob structure isn't modified.
+func ApplyOverlays(copyJob *CopyJob, paths []string, options LoadOptions) (*CopyJob, error) {
+	if len(paths) == 0 {
+		return copyJob, nil
+	}
+
+	options.Overlays = paths
+
+	overlays, err := loadOverlays(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyOverlayFiles(copyJob, overlays, nil)
+}
+
+// loadOverlays decodes the overlay files of the provided LoadOptions
+// structure.
+func loadOverlays(options LoadOptions) ([]*overlayFile, error) {
+	overlays := make([]*overlayFile, len(options.Overlays))
+	for i, path := range options.Overlays {
+		overlay, err := loadOverlay(path, options)
+		if err != nil {
+			return nil, err
+		}
+
+		overlays[i] = overlay
+	}
+
+	return overlays, nil
+}
+
+// overlayFile is a decoded overlay file.
+type overlayFile struct {
+	path   string
+	format Format
+
+	// contents holds the overlay file as it was read.
+	contents []byte
+
+	// data holds the overlay file converted to JSON, once its environment
+	// variables are expanded.
+	data []byte
+
+	// members holds the decoded members of the overlay file.
+	members map[string]interface{}
+
+	root *jsonNode
+}
+
+// line returns the line number of the value at the provided path of the
+// receiver, or 0 if it's unknown.
+func (p *overlayFile) line(path jsonPath) int {
+	if p.format != FormatJSON {
+		return 0
+	}
+
+	if p.root == nil {
+		p.root, _ = parseJSONNode(p.data)
+	}
+
+	if p.root == nil {
+		return 0
+	}
+
+	return lineOf(p.data, p.root.lookup(path))
+}
+
+// overlayChange describes a value of a copy job specification set, or
+// removed, by an overlay file.
+type overlayChange struct {
+	overlay *overlayFile
+
+	// path is the path of the value in the copy job specification, while
+	// overlayPath is its path in the overlay file.
+	path        jsonPath
+	overlayPath jsonPath
+
+	// removed indicates that the overlay file removed the value.
+	removed bool
+}
+
+// applyOverlayFiles applies the provided decoded overlay files, in order, to
+// the provided CopyJob structure, like ApplyOverlays does. If record isn't nil,
+// it's called with every value set or removed by the overlay files.
+func applyOverlayFiles(copyJob *CopyJob, overlays []*overlayFile, record func(*overlayChange)) (*CopyJob, error) {
+	if len(overlays) == 0 {
+		return copyJob, nil
+	}
+
+	jsonBytes, err := json.Marshal(copyJob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spec: %w", err)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(jsonBytes, &document); err != nil {
+		return nil, fmt.Errorf("failed to encode spec: %w", err)
+	}
+
+	for _, overlay := range overlays {
+		merger := &overlayMerger{overlay: overlay, record: record}
+
+		document, err = merger.merge(document, overlay.members, jsonPath{}, jsonPath{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply overlay file %s: %w", overlay.path, err)
+		}
+	}
+
+	jsonBytes, err = json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode overlaid spec: %w", err)
+	}
+
+	var overlaid CopyJob
+	if err := json.NewDecoder(bytes.NewReader(jsonBytes)).Decode(&overlaid); err != nil {
+		return nil, fmt.Errorf("failed to decode overlaid spec: %w", err)
+	}
+
+	return &overlaid, nil
+}
+
+// loadOverlay decodes the overlay file at the provided path.
+func loadOverlay(path string, options LoadOptions) (*overlayFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overlay file %s: %w", path, err)
+	}
+
+	expanded, err := ExpandEnv(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overlay file %s: %w", path, err)
+	}
+
+	format := formatFor(path, options)
+
+	jsonBytes, err := toJSON([]byte(expanded), format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load overlay file %s: %w", path, err)
+	}
+
+	if !options.Lenient {
+		if err := checkUnknownFields(jsonBytes, format == FormatJSON); err != nil {
+			return nil, fmt.Errorf("failed to load overlay file %s: %w", path, err)
+		}
+	}
+
+	var overlay map[string]interface{}
+	if err := json.Unmarshal(jsonBytes, &overlay); err != nil {
+		return nil, fmt.Errorf("failed to decode %s overlay file %s: %w", strings.ToUpper(string(format)), path, err)
+	}
+
+	if _, found := overlay["include"]; found {
+		return nil, fmt.Errorf("overlay file %s cannot include other files", path)
+	}
+
+	return &overlayFile{path: path, format: format, contents: data, data: jsonBytes, members: overlay}, nil
+}
+
+// overlayMerger is a structure that merges an overlay file into a copy job
+// specification, recording the values it sets or removes.
+type overlayMerger struct {
+	overlay *overlayFile
+	record  func(*overlayChange)
+}
+
+// changed records that the value at the provided path, found at the provided
+// path of the overlay file, was set or removed.
+func (p *overlayMerger) changed(path, overlayPath jsonPath, removed bool) {
+	if p.record != nil {
+		p.record(&overlayChange{overlay: p.overlay, path: path, overlayPath: overlayPath, removed: removed})
+	}
+}
+
+// merge merges the provided overlay value, found at the provided path of the
+// overlay file, into the provided value, found at the provided path, and
+// returns the result.
+func (p *overlayMerger) merge(value, overlay interface{}, path, overlayPath jsonPath) (interface{}, error) {
+	overlayObject, ok := overlay.(map[string]interface{})
+	if !ok {
+		p.changed(path, overlayPath, false)
+		return overlay, nil
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{})
+	}
+
+	for key, overlayMember := range overlayObject {
+		if overlayMember == nil {
+			p.changed(path.with(key), overlayPath.with(key), true)
+			delete(object, key)
+			continue
+		}
+
+		var err error
+		if len(path) == 0 && key == "copies" {
+			object[key], err = p.mergeCopies(object[key], overlayMember)
+		} else {
+			object[key], err = p.merge(object[key], overlayMember, path.with(key), overlayPath.with(key))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return object, nil
+}
+
+// mergeCopies merges the provided overlay copies into the provided copies.
+// Each overlay copy is merged into the copy with the same ID, or appended if
+// no copy has its ID.
+func (p *overlayMerger) mergeCopies(value, overlay interface{}) (interface{}, error) {
+	overlayCopies, ok := overlay.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array", jsonPath{"copies"})
+	}
+
+	copies, _ := value.([]interface{})
+
+	indexes := make(map[string]int)
+	for i, copy := range copies {
+		id := copyID(copy)
+		if id == "" {
+			continue
+		}
+
+		if first, found := indexes[id]; found {
+			return nil, fmt.Errorf("%s and %s have the same id %q", jsonPath{"copies", first}, jsonPath{"copies", i}, id)
+		}
+
+		indexes[id] = i
+	}
+
+	for j, overlayCopy := range overlayCopies {
+		i, found := indexes[copyID(overlayCopy)]
+		if !found {
+			p.changed(jsonPath{"copies", len(copies)}, jsonPath{"copies", j}, false)
+			copies = append(copies, overlayCopy)
+			continue
+		}
+
+		merged, err := p.merge(copies[i], overlayCopy, jsonPath{"copies", i}, jsonPath{"copies", j})
+		if err != nil {
+			return nil, err
+		}
+
+		copies[i] = merged
+	}
+
+	return copies, nil
+}
+
+// copyID returns the ID of the provided decoded copy, or an empty string if it
+// has none.
+func copyID(copy interface{}) string {
+	object, ok := copy.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	id, _ := object["id"].(string)
+
+	return id
+}
@@ -0,0 +1,197 @@
+package spec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSpecOverlays(t *testing.T) {
+	directory := t.TempDir()
+	writeSpecFiles(t, directory, map[string]string{
+		"prod.json": `{
+  "target": {"address": "https://vault.prod:8200", "tls": null},
+  "copies": [
+    {"id": "db", "mount-point": "prod-kv", "values": {"password": {"path": "prod/db"}}},
+    {"path": "prod-only", "secret": {"source": "s1"}}
+  ]
+}`,
+		"prod-db.yaml": "copies:\n  - id: db\n    namespace: team-a\n",
+	})
+
+	copyJob, err := LoadSpecOptions(strings.NewReader(`{
+  "target": {"address": "http://vault.dev:8200", "tls": {"insecure": true}},
+  "sources": {"s1": {"address": "http://source:8200"}},
+  "copies": [
+    {"id": "db", "path": "db", "values": {"password": {"source": "s1", "path": "dev/db", "key": "password"}}},
+    {"path": "shared", "secret": {"source": "s1"}}
+  ]
+}`), LoadOptions{
+		Format:   FormatJSON,
+		Overlays: []string{filepath.Join(directory, "prod.json"), filepath.Join(directory, "prod-db.yaml")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &Vault{Address: "https://vault.prod:8200"}, copyJob.Target)
+	assert.Equal(t, "http://source:8200", copyJob.Sources["s1"].Address)
+	assert.Equal(t, []*Copy{
+		{ID: "db", MountPoint: "prod-kv", Path: "db", Namespace: "team-a", Values: map[string]*CopyValue{
+			"password": {Source: "s1", Path: "prod/db", Key: "password"},
+		}},
+		{Path: "shared", Secret: &CopyValue{Source: "s1"}},
+		{Path: "prod-only", Secret: &CopyValue{Source: "s1"}},
+	}, copyJob.Copies)
+}
+
+func TestLoadSpecOverlaysErrors(t *testing.T) {
+	directory := t.TempDir()
+	writeSpecFiles(t, directory, map[string]string{
+		"unknown.json": `{"target": {"adress": "http://vault.prod:8200"}}`,
+		"include.json": `{"include": ["other.json"]}`,
+		"copies.json":  `{"copies": {"id": "db"}}`,
+		"db.json":      `{"copies": [{"id": "db", "path": "prod-db"}]}`,
+	})
+
+	for _, testcase := range []struct {
+		spec          string
+		overlay       string
+		expectedError string
+	}{
+		{
+			spec:          `{"copies": []}`,
+			overlay:       "unknown.json",
+			expectedError: "failed to load overlay file {{file}}: spec contains unknown fields: $.target.adress (line 1)",
+		},
+		{
+			spec:          `{"copies": []}`,
+			overlay:       "include.json",
+			expectedError: "overlay file {{file}} cannot include other files",
+		},
+		{
+			spec:          `{"copies": []}`,
+			overlay:       "copies.json",
+			expectedError: "failed to apply overlay file {{file}}: $.copies must be an array",
+		},
+		{
+			spec:          `{"copies": [{"id": "db", "path": "a"}, {"id": "db", "path": "b"}]}`,
+			overlay:       "db.json",
+			expectedError: `failed to apply overlay file {{file}}: $.copies[0] and $.copies[1] have the same id "db"`,
+		},
+	} {
+		overlay := filepath.Join(directory, testcase.overlay)
+
+		_, err := LoadSpecOptions(strings.NewReader(testcase.spec), LoadOptions{Format: FormatJSON, Overlays: []string{overlay}})
+		assert.EqualError(t, err, strings.ReplaceAll(testcase.expectedError, "{{file}}", overlay))
+	}
+}
+
+func TestLoadSpecFilesOverlays(t *testing.T) {
+	directory := t.TempDir()
+	writeSpecFiles(t, directory, map[string]string{
+		"base/target.json":   `{"target": {"address": "http://vault.dev:8200", "login": {"token": "${file:${HVC_OVERLAY_DIR}/token}"}}}`,
+		"base/copies.json":   `{"copies": [{"id": "db", "path": "db"}]}`,
+		"prod/overlay.json":  `{"target": {"address": "https://vault.prod:8200"}, "copies": [{"id": "db", "path": "prod-db"}]}`,
+		"token":              "my-token",
+		"prod/unrelated.txt": "",
+	})
+
+	overlay := filepath.Join(directory, "prod", "overlay.json")
+	os.Setenv("HVC_OVERLAY_DIR", directory)
+	defer os.Unsetenv("HVC_OVERLAY_DIR")
+
+	copyJob, files, err := LoadSpecFiles([]string{filepath.Join(directory, "base")}, LoadOptions{Overlays: []string{overlay}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(directory, "base", "copies.json"),
+		filepath.Join(directory, "base", "target.json"),
+		overlay,
+	}, files.Paths)
+	assert.Equal(t, "https://vault.prod:8200", copyJob.Target.Address)
+	assert.Equal(t, "my-token", copyJob.Target.Login.Token)
+	assert.Equal(t, "prod-db", copyJob.Copies[0].Path)
+
+	copyJob, _, err = LoadSpecFiles([]string{filepath.Join(directory, "base")}, LoadOptions{Overlays: []string{overlay}, KeepFileReferences: true})
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("${file:%s/token}", directory), copyJob.Target.Login.Token)
+}
+
+func TestValidateFilesOverlays(t *testing.T) {
+	for _, testcase := range []struct {
+		overlay        string
+		expectedErrors []*ValidationError
+	}{
+		// The overlay supplies the target and the values of a copy.
+		{
+			overlay: `{
+  "target": {"address": "https://vault.prod:8200"},
+  "copies": [{"id": "db", "values": {"k1": {"source": "s1", "key": "k"}}}]
+}`,
+			expectedErrors: []*ValidationError{
+				{File: "{{base.json}}", Path: "$.copies[1].secret.source", Line: 5, Message: `source Vault "s2" is not defined in sources`},
+			},
+		},
+		// The overlay retargets a copy to an existing target secret.
+		{
+			overlay: `{
+  "target": {"address": "https://vault.prod:8200"},
+  "copies": [
+    {"id": "db", "values": {"k1": {"source": "s1", "key": "k"}}},
+    {"id": "api", "path": "db"}
+  ]
+}`,
+			expectedErrors: []*ValidationError{
+				{File: "{{base.json}}", Path: "$.copies[1].secret.source", Line: 5, Message: `source Vault "s2" is not defined in sources`},
+				{File: "{{overlay.json}}", Path: "$.copies[1].path", Line: 5, Message: "target secret is already written by $.copies[0] of {{base.json}}"},
+			},
+		},
+		// The overlay removes the values it supplies and adds a copy
+		// referencing an undefined source.
+		{
+			overlay: `{
+  "target": {"address": "https://vault.prod:8200"},
+  "sources": {"s2": {"address": "https://source.prod:8200"}},
+  "copies": [
+    {"id": "db", "values": null},
+    {"path": "cache", "secret": {"source": "s3"}}
+  ]
+}`,
+			expectedErrors: []*ValidationError{
+				{File: "{{overlay.json}}", Path: "$.copies[0]", Line: 5, Message: "copy element must provide either secret or values"},
+				{File: "{{overlay.json}}", Path: "$.copies[1].secret.source", Line: 6, Message: `source Vault "s3" is not defined in sources`},
+			},
+		},
+		// Without a target, the problem is reported in the first file.
+		{
+			overlay: `{"copies": [{"id": "db", "values": {"k1": {"source": "s1", "key": "k"}}}]}`,
+			expectedErrors: []*ValidationError{
+				{File: "{{base.json}}", Path: "$.target", Line: 1, Message: "target Vault must be specified"},
+				{File: "{{base.json}}", Path: "$.copies[1].secret.source", Line: 5, Message: `source Vault "s2" is not defined in sources`},
+			},
+		},
+	} {
+		directory := t.TempDir()
+		writeSpecFiles(t, directory, map[string]string{
+			"base.json": `{
+  "sources": {"s1": {"address": "https://source:8200"}},
+  "copies": [
+    {"id": "db", "path": "db"},
+    {"id": "api", "path": "api", "secret": {"source": "s2"}}
+  ]
+}`,
+			"overlay.json": testcase.overlay,
+		})
+
+		for _, expectedError := range testcase.expectedErrors {
+			for _, name := range []string{"base.json", "overlay.json"} {
+				expectedError.File = strings.ReplaceAll(expectedError.File, "{{"+name+"}}", filepath.Join(directory, name))
+				expectedError.Message = strings.ReplaceAll(expectedError.Message, "{{"+name+"}}", filepath.Join(directory, name))
+			}
+		}
+
+		validationErrors := ValidateFiles([]string{filepath.Join(directory, "base.json")}, LoadOptions{Overlays: []string{filepath.Join(directory, "overlay.json")}})
+		assert.Equal(t, testcase.expectedErrors, validationErrors)
+	}
+}
@@ -0,0 +1,78 @@
+package spec
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CompilePattern compiles the provided pattern, which selects the source
+// secrets of a copy with a prefix by their path relative to the source prefix.
+// A pattern starting with ^ is a regular expression. Any other pattern is a
+// glob that must match the whole relative path, in which * matches any
+// sequence of characters other than /, ** matches any sequence of characters,
+// ? matches any single character other than /, and [...] matches a character
+// class. Each wildcard of a glob is a capture group.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	expression := pattern
+	if !strings.HasPrefix(pattern, "^") {
+		var err error
+		expression, err = globExpression(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	return compiled, nil
+}
+
+// globExpression converts the provided glob into an equivalent regular
+// expression.
+func globExpression(glob string) (string, error) {
+	builder := strings.Builder{}
+	builder.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				builder.WriteString("(.*)")
+				i++
+			} else {
+				builder.WriteString("([^/]*)")
+			}
+		case '?':
+			builder.WriteString("([^/])")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("invalid pattern %q: unterminated character class", glob)
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			builder.WriteString("([" + class + "])")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	builder.WriteString("$")
+
+	return builder.String(), nil
+}
@@ -0,0 +1,44 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilePattern(t *testing.T) {
+	for _, testcase := range []struct {
+		pattern          string
+		path             string
+		expectedCaptures []string
+	}{
+		{pattern: "apps/*/db", path: "apps/billing/db", expectedCaptures: []string{"apps/billing/db", "billing"}},
+		{pattern: "apps/*/db", path: "apps/billing/eu/db"},
+		{pattern: "apps/*/db", path: "apps/billing/db/replica"},
+		{pattern: "apps/**", path: "apps/billing/eu/db", expectedCaptures: []string{"apps/billing/eu/db", "billing/eu/db"}},
+		{pattern: "svc-?/[a-c]*", path: "svc-1/billing", expectedCaptures: []string{"svc-1/billing", "1", "b", "illing"}},
+		{pattern: "svc-[!0-9]", path: "svc-1"},
+		{pattern: `db\*`, path: "db*", expectedCaptures: []string{"db*"}},
+		{pattern: "db.prod", path: "db-prod"},
+		{pattern: "^svc-(.*)/prod$", path: "svc-billing/prod", expectedCaptures: []string{"svc-billing/prod", "billing"}},
+		{pattern: "^svc-(.*)/prod$", path: "svc-billing/staging"},
+	} {
+		expression, err := CompilePattern(testcase.pattern)
+		if assert.NoError(t, err, testcase.pattern) {
+			assert.Equal(t, testcase.expectedCaptures, expression.FindStringSubmatch(testcase.path), testcase.pattern)
+		}
+	}
+
+	for _, pattern := range []string{"apps/[a-", "^svc-(.*"} {
+		_, err := CompilePattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestLoadSpecKeepsCaptureReferences(t *testing.T) {
+	copyJob, err := LoadSpec(strings.NewReader(`{"copies": [{"prefix": "prod", "rewrite": "${1}/db", "secret": {"source": "s1", "include": ["^svc-(.*)/prod$"]}}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "${1}/db", copyJob.Copies[0].Rewrite)
+	assert.Equal(t, []string{"^svc-(.*)/prod$"}, copyJob.Copies[0].Secret.Include)
+}
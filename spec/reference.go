@@ -0,0 +1,175 @@
+package spec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+const (
+	// FileReference is the kind of the references, written as
+	// ${file:/path/to/file}, that are replaced with the contents of a file
+	// when the copy job specification is loaded.
+	FileReference = "file"
+
+	// VaultReference is the kind of the references, written as
+	// ${vault:source-name:mount/path#key}, that are replaced with a value read
+	// from a source Vault server when the copy job is created.
+	VaultReference = "vault"
+)
+
+// referenceKinds lists the kinds of references that are left as-is when
+// environment variables are expanded.
+var referenceKinds = []string{FileReference, VaultReference}
+
+// isReference determines if the provided contents of a ${...} expression are
+// a reference of one of the referenceKinds rather than an environment
+// variable reference.
+func isReference(contents string) bool {
+	for _, kind := range referenceKinds {
+		if strings.HasPrefix(contents, kind+":") {
+			rest := contents[len(kind)+1:]
+			return !strings.HasPrefix(rest, "-") && !strings.HasPrefix(rest, "?")
+		}
+	}
+
+	return false
+}
+
+// expandReferences replaces every reference of the provided kind in the
+// provided text with the value returned by the provided resolve function for
+// it. An escaped reference, written as $${kind:...}, is replaced with the
+// reference itself.
+func expandReferences(text, kind string, resolve func(string) (string, error)) (string, error) {
+	prefix := "${" + kind + ":"
+
+	if !strings.Contains(text, prefix) {
+		return text, nil
+	}
+
+	builder := strings.Builder{}
+
+	for {
+		index := strings.Index(text, prefix)
+		if index < 0 {
+			builder.WriteString(text)
+			return builder.String(), nil
+		}
+
+		if index > 0 && text[index-1] == '$' {
+			builder.WriteString(text[:index-1])
+			builder.WriteString(prefix)
+			text = text[index+len(prefix):]
+			continue
+		}
+
+		builder.WriteString(text[:index])
+		text = text[index+len(prefix):]
+
+		end := strings.IndexByte(text, '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated %s reference %q", kind, prefix+text)
+		}
+
+		value, err := resolve(text[:end])
+		if err != nil {
+			return "", err
+		}
+
+		builder.WriteString(value)
+		text = text[end+1:]
+	}
+}
+
+// ResolveReferences replaces every reference of the provided kind, written as
+// ${kind:reference}, found in the string fields of the provided structure, and
+// of the structures it contains, with the value returned by the provided
+// resolve function for the reference.
+func ResolveReferences(value interface{}, kind string, resolve func(string) (string, error)) error {
+	return resolveReferences(reflect.ValueOf(value), kind, resolve)
+}
+
+// resolveReferences replaces the references found in the provided value.
+func resolveReferences(value reflect.Value, kind string, resolve func(string) (string, error)) error {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+
+		return resolveReferences(value.Elem(), kind, resolve)
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath != "" {
+				continue
+			}
+
+			if err := resolveReferences(value.Field(i), kind, resolve); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range value.MapKeys() {
+			element := value.MapIndex(key)
+			if element.Kind() == reflect.String {
+				expanded, err := expandReferences(element.String(), kind, resolve)
+				if err != nil {
+					return err
+				}
+
+				value.SetMapIndex(key, reflect.ValueOf(expanded).Convert(element.Type()))
+				continue
+			}
+
+			if err := resolveReferences(element, kind, resolve); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			if err := resolveReferences(value.Index(i), kind, resolve); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if !value.CanSet() {
+			return nil
+		}
+
+		expanded, err := expandReferences(value.String(), kind, resolve)
+		if err != nil {
+			return err
+		}
+
+		value.SetString(expanded)
+	}
+
+	return nil
+}
+
+// readFileReference returns the contents of the file at the provided path,
+// without its trailing line breaks.
+func readFileReference(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file referenced by ${file:%s}: %w", path, err)
+	}
+
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+// ParseVaultReference splits the provided Vault reference, written as
+// source-name:mount/path#key, into the name of the source Vault server, the
+// full logical path of the secret, and the key of the value within the
+// secret.
+func ParseVaultReference(reference string) (string, string, string, error) {
+	colon := strings.IndexByte(reference, ':')
+	hash := strings.LastIndexByte(reference, '#')
+
+	if colon <= 0 || hash < colon+2 || hash == len(reference)-1 {
+		return "", "", "", fmt.Errorf("invalid Vault reference ${vault:%s}, expected ${vault:source-name:mount/path#key}", reference)
+	}
+
+	return reference[:colon], reference[colon+1 : hash], reference[hash+1:], nil
+}
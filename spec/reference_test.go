@@ -0,0 +1,70 @@
+package spec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSpecFileReferences(t *testing.T) {
+	directory := t.TempDir()
+	tokenFile := filepath.Join(directory, "token")
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("my-token\n"), 0600))
+
+	os.Setenv("HVC_REFERENCE_DIR", directory)
+	defer os.Unsetenv("HVC_REFERENCE_DIR")
+
+	copyJob, err := LoadSpec(strings.NewReader(`{
+  "target": {"login": {"token": "${file:${HVC_REFERENCE_DIR}/token}"}},
+  "sources": {"s1": {"login": {"token": "${vault:s0:secret/tokens#s1}"}}},
+  "copies": [{"path": "literal-$${file:/etc/passwd}"}]
+}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "my-token", copyJob.Target.Login.Token)
+	assert.Equal(t, "${vault:s0:secret/tokens#s1}", copyJob.Sources["s1"].Login.Token)
+	assert.Equal(t, "literal-${file:/etc/passwd}", copyJob.Copies[0].Path)
+
+	_, err = LoadSpec(strings.NewReader(`{"target": {"login": {"token": "${file:/does/not/exist}"}}}`))
+	assert.Error(t, err)
+}
+
+func TestResolveReferences(t *testing.T) {
+	copyJob := &CopyJob{
+		Target: &Vault{Login: &VaultLogin{Token: "${vault:s1:kv/a#k}"}},
+		Sources: map[string]*Vault{
+			"s1": {Address: "http://${vault:s1:kv/b#k}:8200"},
+		},
+		Copies: []*Copy{
+			{Path: "$${vault:s1:kv/c#k}", Values: map[string]*CopyValue{"k": {Key: "${vault:s1:kv/d#k}"}}},
+		},
+	}
+
+	references := []string{}
+	err := ResolveReferences(copyJob, VaultReference, func(reference string) (string, error) {
+		references = append(references, reference)
+		return "resolved", nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"s1:kv/a#k", "s1:kv/b#k", "s1:kv/d#k"}, references)
+	assert.Equal(t, "resolved", copyJob.Target.Login.Token)
+	assert.Equal(t, "http://resolved:8200", copyJob.Sources["s1"].Address)
+	assert.Equal(t, "${vault:s1:kv/c#k}", copyJob.Copies[0].Path)
+	assert.Equal(t, "resolved", copyJob.Copies[0].Values["k"].Key)
+}
+
+func TestParseVaultReference(t *testing.T) {
+	source, path, key, err := ParseVaultReference("source-name:kv/path/to/secret#key")
+	assert.NoError(t, err)
+	assert.Equal(t, "source-name", source)
+	assert.Equal(t, "kv/path/to/secret", path)
+	assert.Equal(t, "key", key)
+
+	for _, reference := range []string{"kv/path#key", ":kv/path#key", "s1:kv/path", "s1:#key", "s1:kv/path#"} {
+		_, _, _, err := ParseVaultReference(reference)
+		assert.Error(t, err, reference)
+	}
+}
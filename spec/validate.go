@@ -0,0 +1,844 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// ValidationError is a structure that describes a problem found in a copy job
+// specification, along with its location.
+type ValidationError struct {
+	// File is the path of the copy job specification file in which the
+	// problem is found. It's empty when a single document is validated.
+	File string
+
+	// Path is the JSON path of the offending value, such as
+	// $.copies[0].secret.source.
+	Path string
+
+	// Line is the line number of the offending value in the copy job
+	// specification. When the offending value is missing, it's the line number
+	// of the value that should contain it. It's 0 when the line number is
+	// unknown.
+	Line int
+
+	// Message describes the problem.
+	Message string
+}
+
+func (p *ValidationError) Error() string {
+	location := p.Path
+	if p.Line != 0 {
+		location = fmt.Sprintf("line %d: %s", p.Line, p.Path)
+	}
+
+	if p.File != "" {
+		location = fmt.Sprintf("%s: %s", p.File, location)
+	}
+
+	return fmt.Sprintf("%s: %s", location, p.Message)
+}
+
+// Validate checks the provided JSON copy job specification document without
+// connecting to any Vault server and returns every problem found, sorted by
+// line number. An empty slice is returned if the specification is valid.
+func Validate(data []byte) []*ValidationError {
+	return ValidateOptions(data, LoadOptions{Format: FormatJSON})
+}
+
+// ValidateFormat checks the provided copy job specification document, written
+// in the provided Format, like Validate does.
+func ValidateFormat(data []byte, format Format) []*ValidationError {
+	return ValidateOptions(data, LoadOptions{Format: format})
+}
+
+// ValidateOptions checks the provided copy job specification document, loaded
+// as specified by the provided LoadOptions structure, like Validate does.
+// Unknown fields are only reported if the Lenient field is false. Since YAML
+// and HCL documents are converted to JSON before being checked, the problems
+// found in them have no line number. The overlays of the LoadOptions structure
+// are checked as ValidateFiles does.
+func ValidateOptions(data []byte, options LoadOptions) []*ValidationError {
+	document := &specDocument{data: data, format: options.Format}
+
+	// The Format only describes the document, so the format of each overlay
+	// file is determined by its extension.
+	options.Format = ""
+
+	return validateDocuments([]*specDocument{document}, options)
+}
+
+// ValidateFiles checks the copy job specification files at the provided paths,
+// along with the files they include, as they would be loaded by LoadSpecFiles,
+// and returns every problem found, sorted by file and line number. Besides the
+// problems found in each file, the conflicts between the files are reported,
+// as well as the overlays of the provided LoadOptions structure that can't be
+// loaded. When overlays are provided, the copies, logins and target of the
+// specification are checked once the overlays are applied, as LoadSpecFiles
+// does, and their problems are reported in the file, copy job specification
+// file or overlay file, that the offending values come from.
+func ValidateFiles(paths []string, options LoadOptions) []*ValidationError {
+	documents, err := collectSpecFiles(paths, options)
+	if err != nil {
+		return []*ValidationError{{Path: "$", Message: err.Error()}}
+	}
+
+	return validateDocuments(documents, options)
+}
+
+// specDocument is a copy job specification document to validate.
+type specDocument struct {
+	file   string
+	data   []byte
+	format Format
+
+	// rawJSON and expandedJSON hold the document converted to JSON, before
+	// and after its environment variables are expanded.
+	rawJSON      []byte
+	expandedJSON []byte
+
+	// copyJob holds the decoded document, once its environment variables are
+	// expanded.
+	copyJob *CopyJob
+
+	root *jsonNode
+}
+
+// node returns the node of the receiver, before its environment variables are
+// expanded, at the provided path, or nil if there is none.
+func (p *specDocument) node(path jsonPath) *jsonNode {
+	if p.root == nil {
+		p.root, _ = parseJSONNode(p.rawJSON)
+	}
+
+	return p.root.at(path)
+}
+
+// line returns the line number of the value at the provided path of the
+// receiver, or 0 if it's unknown.
+func (p *specDocument) line(path jsonPath) int {
+	if p.format != FormatJSON && p.format != "" {
+		return 0
+	}
+
+	if p.root == nil {
+		p.root, _ = parseJSONNode(p.rawJSON)
+	}
+
+	if p.root == nil {
+		return 0
+	}
+
+	return lineOf(p.rawJSON, p.root.lookup(path))
+}
+
+// validationContext is a structure that holds what the documents validated
+// together know about each other.
+type validationContext struct {
+	// targetDefined indicates that a document defines the target, and
+	// targetFile is the file of the first such document.
+	targetDefined bool
+	targetFile    string
+
+	// sourceFiles maps the name of each source to the file of the first
+	// document that defines it.
+	sourceFiles map[string]string
+
+	// copyOrigins maps the target secret of each copy to the location of the
+	// first copy that writes it.
+	copyOrigins map[string]copyOrigin
+
+	// incomplete indicates that a document couldn't be decoded.
+	incomplete bool
+
+	// deferred indicates that the copies, logins and target of the documents
+	// are checked once the overlays are applied to them, since the overlays
+	// can change them.
+	deferred bool
+}
+
+// copyOrigin is the location of a copy.
+type copyOrigin struct {
+	file string
+	path jsonPath
+}
+
+// validateDocuments checks the provided documents, which are merged into a
+// single copy job, loaded as specified by the provided LoadOptions structure.
+func validateDocuments(documents []*specDocument, options LoadOptions) []*ValidationError {
+	context := &validationContext{
+		sourceFiles: make(map[string]string),
+		copyOrigins: make(map[string]copyOrigin),
+		deferred:    len(options.Overlays) > 0,
+	}
+
+	validationErrors := []*ValidationError{}
+
+	overlays := []*overlayFile{}
+	for _, path := range options.Overlays {
+		overlay, err := loadOverlay(path, options)
+		if err != nil {
+			validationErrors = append(validationErrors, &ValidationError{File: path, Path: "$", Message: err.Error()})
+			context.incomplete = true
+			continue
+		}
+
+		overlays = append(overlays, overlay)
+	}
+
+	// The target and sources of every document are registered first, so that
+	// a copy can reference a source defined by any document.
+	for _, document := range documents {
+		if err := document.convert(); err != nil {
+			validationErrors = append(validationErrors, &ValidationError{File: document.file, Path: "$", Message: err.Error()})
+			context.incomplete = true
+			continue
+		}
+
+		var copyJob CopyJob
+		if err := json.Unmarshal(document.expandedJSON, &copyJob); err != nil {
+			context.incomplete = true
+			continue
+		}
+
+		document.copyJob = &copyJob
+
+		if copyJob.Target != nil && !context.targetDefined {
+			context.targetDefined = true
+			context.targetFile = document.file
+		}
+
+		for name := range copyJob.Sources {
+			if _, found := context.sourceFiles[name]; !found {
+				context.sourceFiles[name] = document.file
+			}
+		}
+	}
+
+	// The sources of the overlays can be referenced by the documents.
+	for _, overlay := range overlays {
+		sources, _ := overlay.members["sources"].(map[string]interface{})
+		for name := range sources {
+			if _, found := context.sourceFiles[name]; !found {
+				context.sourceFiles[name] = overlay.path
+			}
+		}
+	}
+
+	for _, document := range documents {
+		if document.rawJSON == nil {
+			continue
+		}
+
+		documentErrors := validateJSON(document.rawJSON, document.expandedJSON, options.Lenient, document.file, context)
+		for _, validationError := range documentErrors {
+			validationError.File = document.file
+			if document.format != FormatJSON && document.format != "" {
+				validationError.Line = 0
+			}
+		}
+
+		validationErrors = append(validationErrors, documentErrors...)
+	}
+
+	if context.incomplete {
+		return validationErrors
+	}
+
+	if context.deferred {
+		return append(validationErrors, validateOverlaid(documents, overlays, context)...)
+	}
+
+	if !context.targetDefined {
+		validationErrors = append(validationErrors, &ValidationError{
+			File:    documents[0].file,
+			Path:    jsonPath{"target"}.String(),
+			Message: "target Vault must be specified",
+		})
+	}
+
+	return validationErrors
+}
+
+// validateOverlaid checks the copy job obtained by merging the provided
+// documents, as LoadSpecFiles does, and applying the provided overlays to it.
+// The problems found are reported in the documents or overlays that the
+// offending values come from.
+func validateOverlaid(documents []*specDocument, overlays []*overlayFile, context *validationContext) []*ValidationError {
+	overlaid := &overlaidSpec{
+		documents:   make(map[string]*specDocument),
+		firstFile:   documents[0].file,
+		targetFile:  context.targetFile,
+		sourceFiles: context.sourceFiles,
+	}
+
+	merged := &CopyJob{
+		Sources: make(map[string]*Vault),
+		Copies:  []*Copy{},
+	}
+
+	for _, document := range documents {
+		overlaid.documents[document.file] = document
+
+		if document.copyJob.Target != nil && merged.Target == nil {
+			merged.Target = document.copyJob.Target
+		}
+
+		for name, source := range document.copyJob.Sources {
+			if _, found := merged.Sources[name]; !found {
+				merged.Sources[name] = source
+			}
+		}
+
+		for i, copy := range document.copyJob.Copies {
+			overlaid.copyOrigins = append(overlaid.copyOrigins, copyOrigin{file: document.file, path: jsonPath{"copies", i}})
+			merged.Copies = append(merged.Copies, copy)
+		}
+	}
+
+	copyJob, err := applyOverlayFiles(merged, overlays, func(change *overlayChange) {
+		overlaid.changes = append(overlaid.changes, change)
+	})
+	if err != nil {
+		return []*ValidationError{{File: overlays[len(overlays)-1].path, Path: "$", Message: err.Error()}}
+	}
+
+	validator := &validator{
+		overlaid: overlaid,
+		context: &validationContext{
+			sourceFiles: make(map[string]string),
+			copyOrigins: make(map[string]copyOrigin),
+		},
+	}
+
+	for name := range copyJob.Sources {
+		validator.context.sourceFiles[name] = ""
+	}
+
+	if copyJob.Target == nil {
+		validator.report(jsonPath{"target"}, "target Vault must be specified")
+	}
+
+	validator.checkContents(copyJob)
+
+	return validator.errors
+}
+
+// overlaidSpec is a structure that locates the values of a copy job
+// specification, obtained by merging documents and applying overlays to them,
+// in the documents or overlays they come from.
+type overlaidSpec struct {
+	// documents maps the file of each document to the document.
+	documents map[string]*specDocument
+
+	// firstFile is the file of the first document.
+	firstFile string
+
+	// targetFile is the file of the document that defines the target, and
+	// sourceFiles maps the name of each source to the file of the document
+	// that defines it.
+	targetFile  string
+	sourceFiles map[string]string
+
+	// copyOrigins holds the location of every copy of the documents, in the
+	// order in which they are merged.
+	copyOrigins []copyOrigin
+
+	// changes holds the values set or removed by the overlays, in the order
+	// in which the overlays are applied.
+	changes []*overlayChange
+}
+
+// specLocation is the location of a value within a document or an overlay.
+type specLocation struct {
+	file string
+	path jsonPath
+
+	// line is the line number of the value, or 0 if it's unknown.
+	line int
+
+	// node is the value, before the environment variables of a document are
+	// expanded, or nil if it's missing or located in an overlay.
+	node *jsonNode
+}
+
+// locate returns the location of the value at the provided path. A value set
+// or removed by an overlay, or contained in such a value, is located in the
+// last overlay that changed it, while any other value is located in the
+// document that defines it.
+func (p *overlaidSpec) locate(path jsonPath) *specLocation {
+	for i := len(p.changes) - 1; i >= 0; i-- {
+		change := p.changes[i]
+
+		var overlayPath jsonPath
+		switch {
+		case path.hasPrefix(change.path):
+			overlayPath = change.overlayPath.with(path[len(change.path):]...)
+		case change.removed && change.path.hasPrefix(path):
+			overlayPath = change.overlayPath[:len(path)]
+		default:
+			continue
+		}
+
+		return &specLocation{
+			file: change.overlay.path,
+			path: overlayPath,
+			line: change.overlay.line(overlayPath),
+		}
+	}
+
+	file, documentPath := p.firstFile, path
+	switch {
+	case len(path) > 0 && path[0] == "target" && p.targetFile != "":
+		file = p.targetFile
+	case len(path) > 1 && path[0] == "sources":
+		name, _ := path[1].(string)
+		if sourceFile, found := p.sourceFiles[name]; found {
+			file = sourceFile
+		}
+	case len(path) > 1 && path[0] == "copies":
+		if i, ok := path[1].(int); ok && i < len(p.copyOrigins) {
+			file = p.copyOrigins[i].file
+			documentPath = p.copyOrigins[i].path.with(path[2:]...)
+		}
+	}
+
+	document := p.documents[file]
+
+	return &specLocation{
+		file: file,
+		path: documentPath,
+		line: document.line(documentPath),
+		node: document.node(documentPath),
+	}
+}
+
+// convert converts the receiver to JSON, before and after its environment
+// variables are expanded.
+func (p *specDocument) convert() error {
+	rawJSON, err := toJSON(p.data, p.format)
+	if err != nil {
+		return err
+	}
+
+	expandedJSON, err := toJSON([]byte(expandLeniently(string(p.data))), p.format)
+	if err != nil {
+		return err
+	}
+
+	p.rawJSON = rawJSON
+	p.expandedJSON = expandedJSON
+
+	return nil
+}
+
+// validateJSON checks the provided JSON document, whose environment variables
+// are expanded in the provided expanded JSON document. Unknown fields are only
+// reported if lenient is false.
+func validateJSON(data, expanded []byte, lenient bool, file string, context *validationContext) []*ValidationError {
+	validator := &validator{data: data, file: file, context: context}
+
+	root, err := parseJSONNode(data)
+	if err != nil {
+		var jsonSyntaxError *json.SyntaxError
+		if errors.As(err, &jsonSyntaxError) {
+			return []*ValidationError{{Path: "$", Line: lineOf(data, int(jsonSyntaxError.Offset)), Message: jsonSyntaxError.Error()}}
+		}
+
+		return []*ValidationError{{Path: "$", Line: 1, Message: err.Error()}}
+	}
+
+	validator.root = root
+
+	if !lenient {
+		checkFields(root, reflect.TypeOf(CopyJob{}), jsonPath{}, validator.reportAt)
+	}
+
+	var copyJob CopyJob
+	if err := json.Unmarshal(expanded, &copyJob); err != nil {
+		validator.report(jsonPath{}, fmt.Sprintf("failed to decode JSON spec: %s", err))
+	} else {
+		validator.checkCopyJob(&copyJob)
+	}
+
+	validator.checkExpansions(root, jsonPath{})
+
+	sort.SliceStable(validator.errors, func(i, j int) bool {
+		return validator.errors[i].Line < validator.errors[j].Line
+	})
+
+	return validator.errors
+}
+
+// validator is a structure that accumulates the problems found in a copy job
+// specification document.
+type validator struct {
+	data    []byte
+	file    string
+	root    *jsonNode
+	context *validationContext
+	errors  []*ValidationError
+
+	// overlaid locates the values checked by the receiver when it checks a
+	// copy job specification to which overlays are applied, instead of a
+	// single document.
+	overlaid *overlaidSpec
+}
+
+// describe returns a description of the document of the provided file, for
+// messages about conflicts with the receiver's document.
+func (p *validator) describe(file string) string {
+	if file == "" {
+		return "this document"
+	}
+
+	return file
+}
+
+// report records a problem with the value at the provided path, or with its
+// closest existing ancestor if the value is missing.
+func (p *validator) report(path jsonPath, message string) {
+	if p.overlaid != nil {
+		location := p.overlaid.locate(path)
+		p.errors = append(p.errors, &ValidationError{
+			File:    location.file,
+			Path:    location.path.String(),
+			Line:    location.line,
+			Message: message,
+		})
+
+		return
+	}
+
+	p.reportAt(path, p.root.lookup(path), message)
+}
+
+// originOf returns the location of the value at the provided path.
+func (p *validator) originOf(path jsonPath) copyOrigin {
+	if p.overlaid != nil {
+		location := p.overlaid.locate(path)
+		return copyOrigin{file: location.file, path: location.path}
+	}
+
+	return copyOrigin{file: p.file, path: path}
+}
+
+// reportAt records a problem with the value at the provided path, located at
+// the provided byte offset.
+func (p *validator) reportAt(path jsonPath, offset int, message string) {
+	p.errors = append(p.errors, &ValidationError{
+		Path:    path.String(),
+		Line:    lineOf(p.data, offset),
+		Message: message,
+	})
+}
+
+// checkExpansions reports every environment variable reference of the
+// provided node, or of its descendants, that can't be resolved or expands to
+// an empty string.
+func (p *validator) checkExpansions(node *jsonNode, path jsonPath) {
+	switch node.kind {
+	case '{':
+		for _, member := range node.members {
+			p.checkString(member.key, path.with(member.key), member.offset)
+			p.checkExpansions(member.value, path.with(member.key))
+		}
+	case '[':
+		for i, element := range node.elements {
+			p.checkExpansions(element, path.with(i))
+		}
+	default:
+		if value, ok := node.value.(string); ok {
+			p.checkString(value, path, node.offset)
+		}
+	}
+}
+
+// checkString reports every environment variable reference of the provided
+// string that can't be resolved or expands to an empty string, as well as
+// every file reference to a missing file and every Vault reference to an
+// undefined source Vault.
+func (p *validator) checkString(value string, path jsonPath, offset int) {
+	expanded, err := expandVariables(value, func(reference *variableReference) string {
+		value, problem := resolveVariable(reference)
+		switch {
+		case problem != "":
+			p.reportAt(path, offset, fmt.Sprintf("environment variable %s", problem))
+		case value == "" && !reference.HasDefault:
+			p.reportAt(path, offset, fmt.Sprintf("environment variable %s expands to an empty string", reference.Name))
+		}
+
+		return value
+	})
+	if err != nil {
+		p.reportAt(path, offset, err.Error())
+		return
+	}
+
+	_, err = expandReferences(expanded, FileReference, func(reference string) (string, error) {
+		if _, err := os.Stat(reference); err != nil {
+			p.reportAt(path, offset, fmt.Sprintf("referenced file %s is not readable: %s", reference, err))
+		}
+
+		return "", nil
+	})
+	if err != nil {
+		p.reportAt(path, offset, err.Error())
+	}
+
+	_, err = expandReferences(expanded, VaultReference, func(reference string) (string, error) {
+		sourceName, _, _, err := ParseVaultReference(reference)
+		if err != nil {
+			p.reportAt(path, offset, err.Error())
+		} else if _, found := p.context.sourceFiles[sourceName]; !p.context.incomplete && !found {
+			p.reportAt(path, offset, fmt.Sprintf("source Vault %q is not defined in sources", sourceName))
+		}
+
+		return "", nil
+	})
+	if err != nil {
+		p.reportAt(path, offset, err.Error())
+	}
+}
+
+// checkCopyJob reports the problems found in the provided CopyJob structure,
+// decoded from the document. Unless they are deferred until the overlays are
+// applied, the problems of its copies, logins and target are reported too.
+func (p *validator) checkCopyJob(copyJob *CopyJob) {
+	if copyJob.Target != nil && p.context.targetFile != p.file {
+		p.report(jsonPath{"target"}, fmt.Sprintf("target is already defined in %s", p.describe(p.context.targetFile)))
+	}
+
+	for _, name := range sortedSourceNames(copyJob) {
+		if sourceFile := p.context.sourceFiles[name]; sourceFile != p.file {
+			p.report(jsonPath{"sources", name}, fmt.Sprintf("source Vault %q is already defined in %s", name, p.describe(sourceFile)))
+		}
+	}
+
+	if !p.context.deferred {
+		p.checkContents(copyJob)
+	}
+}
+
+// checkContents reports the problems found in the target, sources and copies
+// of the provided CopyJob structure.
+func (p *validator) checkContents(copyJob *CopyJob) {
+	if copyJob.Target != nil {
+		p.checkVault(copyJob.Target, jsonPath{"target"})
+	}
+
+	for _, name := range sortedSourceNames(copyJob) {
+		if copyJob.Sources[name] == nil {
+			p.report(jsonPath{"sources", name}, "source Vault must not be null")
+			continue
+		}
+
+		p.checkVault(copyJob.Sources[name], jsonPath{"sources", name})
+	}
+
+	for i, copy := range copyJob.Copies {
+		path := jsonPath{"copies", i}
+		if copy == nil {
+			p.report(path, "copy element must not be null")
+			continue
+		}
+
+		p.checkCopy(copy, path)
+
+		if copy.Path == "" {
+			continue
+		}
+
+		if origin, found := p.context.copyOrigins[copy.targetKey()]; found {
+			first := origin.path.String()
+			if origin.file != p.originOf(path.with("path")).file {
+				first = fmt.Sprintf("%s of %s", first, origin.file)
+			}
+
+			p.report(path.with("path"), fmt.Sprintf("target secret is already written by %s", first))
+		} else {
+			p.context.copyOrigins[copy.targetKey()] = p.originOf(path)
+		}
+	}
+}
+
+// sortedSourceNames returns the names of the sources of the provided CopyJob
+// structure, sorted.
+func sortedSourceNames(copyJob *CopyJob) []string {
+	names := make([]string, 0, len(copyJob.Sources))
+	for name := range copyJob.Sources {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// checkVault reports the problems found in the provided Vault structure.
+func (p *validator) checkVault(vault *Vault, path jsonPath) {
+	if vault.Login == nil {
+		return
+	}
+
+	// A token or token file whose environment variables fail to expand is
+	// already reported by checkExpansions, so it still counts as a login
+	// strategy.
+	login := *vault.Login
+	if login.Token == "" && p.expandsToEmpty(path.with("login", "token")) {
+		login.Token = "unexpanded"
+	}
+
+	if login.TokenFile == "" && p.expandsToEmpty(path.with("login", "token-file")) {
+		login.TokenFile = "unexpanded"
+	}
+
+	if err := login.Validate(); err != nil {
+		p.report(path.with("login"), err.Error())
+	}
+
+	if vault.Login.Cert != nil && (vault.TLS == nil || vault.TLS.ClientCert == "") {
+		p.report(path.with("login", "cert"), "cert login strategy requires a client certificate in the tls section")
+	}
+}
+
+// expandsToEmpty determines if the value at the provided path of the document
+// is a non-empty string whose environment variable references expand to an
+// empty string, such as references to unset environment variables.
+func (p *validator) expandsToEmpty(path jsonPath) bool {
+	node := p.root.at(path)
+	if p.overlaid != nil {
+		node = p.overlaid.locate(path).node
+	}
+
+	if node == nil {
+		return false
+	}
+
+	value, ok := node.value.(string)
+	if !ok || value == "" {
+		return false
+	}
+
+	expanded, err := expandVariables(value, func(reference *variableReference) string {
+		value, _ := resolveVariable(reference)
+		return value
+	})
+
+	return err != nil || expanded == ""
+}
+
+// checkCopy reports the problems found in the provided Copy structure.
+func (p *validator) checkCopy(copy *Copy, path jsonPath) {
+	switch {
+	case copy.Path != "" && copy.Prefix != "":
+		p.report(path.with("prefix"), "copy element cannot contain both path and prefix")
+	case copy.IsPrefix():
+		p.checkPrefixCopy(copy, path)
+	case copy.Path == "":
+		p.report(path.with("path"), "copy element must provide a target secret path")
+	case copy.Secret != nil && copy.Secret.Prefix != "":
+		p.report(path.with("secret", "prefix"), "secret prefix requires a copy element prefix")
+	case copy.Rewrite != "":
+		p.report(path.with("rewrite"), "rewrite requires a copy element prefix")
+	case copy.Mirror != nil:
+		p.report(path.with("mirror"), "mirror requires a copy element prefix")
+	case copy.Secret != nil && len(copy.Secret.Include)+len(copy.Secret.Exclude) != 0:
+		p.report(path.with("secret"), "include and exclude patterns require a copy element prefix")
+	}
+
+	p.checkKVVersion(copy.KVVersion, path)
+
+	if copy.ConflictRetries < 0 {
+		p.report(path.with("conflict-retries"), "conflict-retries cannot be negative")
+	}
+
+	if copy.Merge != nil && copy.Merge.RemoveUnmapped && copy.KVVersion == 1 {
+		p.report(path.with("merge", "remove-unmapped"), "remove-unmapped requires a KV version 2 target secret")
+	}
+
+	switch {
+	case copy.Secret != nil && len(copy.Values) != 0:
+		p.report(path.with("values"), "copy element cannot contain both secret and values")
+	case copy.Secret != nil:
+		p.checkCopyValue(copy.Secret, path.with("secret"))
+	case len(copy.Values) == 0:
+		p.report(path, "copy element must provide either secret or values")
+	default:
+		keys := make([]string, 0, len(copy.Values))
+		for key := range copy.Values {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if copy.Values[key] == nil {
+				p.report(path.with("values", key), "secret value must not be null")
+				continue
+			}
+
+			p.checkCopyValue(copy.Values[key], path.with("values", key))
+		}
+	}
+}
+
+// checkPrefixCopy reports the problems specific to the provided Copy
+// structure, which copies every secret found under a prefix.
+func (p *validator) checkPrefixCopy(copy *Copy, path jsonPath) {
+	if _, err := CleanPrefix(copy.Prefix); err != nil {
+		p.report(path.with("prefix"), err.Error())
+	}
+
+	switch {
+	case copy.Secret == nil:
+		p.report(path.with("secret"), "copy element with a prefix must provide a secret")
+	case copy.Secret.Path != "":
+		p.report(path.with("secret", "path"), "secret of a copy element with a prefix cannot contain a path")
+	case copy.Secret.Prefix != "":
+		if _, err := CleanPrefix(copy.Secret.Prefix); err != nil {
+			p.report(path.with("secret", "prefix"), err.Error())
+		}
+	}
+
+	if copy.Mirror != nil {
+		if err := copy.Mirror.Check(); err != nil {
+			p.report(path.with("mirror"), err.Error())
+		}
+	}
+
+	if copy.Secret != nil {
+		p.checkPatterns(copy.Secret.Include, path.with("secret", "include"))
+		p.checkPatterns(copy.Secret.Exclude, path.with("secret", "exclude"))
+	}
+}
+
+// checkPatterns reports the provided patterns that can't be compiled.
+func (p *validator) checkPatterns(patterns []string, path jsonPath) {
+	for i, pattern := range patterns {
+		if _, err := CompilePattern(pattern); err != nil {
+			p.report(path.with(i), err.Error())
+		}
+	}
+}
+
+// checkCopyValue reports the problems found in the provided CopyValue
+// structure.
+func (p *validator) checkCopyValue(value *CopyValue, path jsonPath) {
+	if _, found := p.context.sourceFiles[value.Source]; !p.context.incomplete && !found {
+		p.report(path.with("source"), fmt.Sprintf("source Vault %q is not defined in sources", value.Source))
+	}
+
+	p.checkKVVersion(value.KVVersion, path)
+}
+
+// checkKVVersion reports an unsupported KV version.
+func (p *validator) checkKVVersion(version int, path jsonPath) {
+	if version < 0 || version > 2 {
+		p.report(path.with("kv-version"), fmt.Sprintf("unsupported KV version %d", version))
+	}
+}
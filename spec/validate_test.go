@@ -0,0 +1,210 @@
+package spec
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	os.Setenv("HVC_VALIDATE_ADDR", "http://source:8200")
+	os.Unsetenv("HVC_VALIDATE_UNSET")
+	defer os.Unsetenv("HVC_VALIDATE_ADDR")
+
+	for _, testcase := range []struct {
+		input          string
+		expectedErrors []*ValidationError
+	}{
+		// Valid specification
+		{
+			input: `{
+  "target": {"address": "http://target:8200"},
+  "sources": {"s1": {"address": "${HVC_VALIDATE_ADDR}"}},
+  "copies": [
+    {"path": "p1", "secret": {"source": "s1"}},
+    {"path": "p2", "values": {"k1": {"source": "s1", "key": "k"}}}
+  ]
+}`,
+			expectedErrors: []*ValidationError{},
+		},
+		// Syntax error
+		{
+			input: `{
+  "target": {"address": "http://target:8200"},,
+}`,
+			expectedErrors: []*ValidationError{
+				{Path: "$", Line: 2, Message: "invalid character ',' looking for beginning of value"},
+			},
+		},
+		// Every kind of problem
+		{
+			input: `{
+  "target": {"adress": "http://target:8200"},
+  "sources": {"s1": {"address": "${HVC_VALIDATE_UNSET}"}},
+  "copies": [
+    {"secret": {"source": "s1"}},
+    {"path": "p1", "secret": {"source": "s1"}, "values": {"k1": {"source": "s1"}}},
+    {"path": "p2", "values": {"k1": {"source": "s2"}}},
+    {
+      "namespace": "",
+      "path": "p2",
+      "secret": {"source": "s1"}
+    }
+  ]
+}`,
+			expectedErrors: []*ValidationError{
+				{Path: "$.target.adress", Line: 2, Message: `unknown field "adress"`},
+				{Path: "$.sources.s1.address", Line: 3, Message: "environment variable HVC_VALIDATE_UNSET is not set"},
+				{Path: "$.copies[0].path", Line: 5, Message: "copy element must provide a target secret path"},
+				{Path: "$.copies[1].values", Line: 6, Message: "copy element cannot contain both secret and values"},
+				{Path: "$.copies[2].values.k1.source", Line: 7, Message: `source Vault "s2" is not defined in sources`},
+				{Path: "$.copies[3].path", Line: 10, Message: "target secret is already written by $.copies[2]"},
+			},
+		},
+	} {
+		validationErrors := Validate([]byte(testcase.input))
+		if len(testcase.expectedErrors) == 0 {
+			assert.Empty(t, validationErrors)
+		} else {
+			assert.Equal(t, testcase.expectedErrors, validationErrors)
+		}
+	}
+}
+
+func TestJSONPathString(t *testing.T) {
+	assert.Equal(t, "$", jsonPath{}.String())
+	assert.Equal(t, "$.copies[3].values.k1", jsonPath{"copies", 3, "values", "k1"}.String())
+	assert.Equal(t, `$.sources["my source"]`, jsonPath{"sources", "my source"}.String())
+}
+
+func TestValidateOptionsLenient(t *testing.T) {
+	input := `{"target": {"adress": "http://target:8200"}, "sources": {}, "copies": []}`
+
+	assert.Len(t, Validate([]byte(input)), 1)
+	assert.Empty(t, ValidateOptions([]byte(input), LoadOptions{Format: FormatJSON, Lenient: true}))
+}
+
+func TestValidateReferences(t *testing.T) {
+	validationErrors := Validate([]byte(`{
+  "target": {"login": {"token": "${file:/does/not/exist}"}},
+  "sources": {"s1": {"login": {"token": "${vault:s2:kv/tokens#s1}"}}},
+  "copies": [{"path": "p1", "secret": {"source": "s1"}}]
+}`))
+
+	assert.Len(t, validationErrors, 2)
+	assert.Equal(t, "$.target.login.token", validationErrors[0].Path)
+	assert.Equal(t, 2, validationErrors[0].Line)
+	assert.Contains(t, validationErrors[0].Message, "referenced file /does/not/exist is not readable")
+	assert.Equal(t, &ValidationError{Path: "$.sources.s1.login.token", Line: 3, Message: `source Vault "s2" is not defined in sources`}, validationErrors[1])
+}
+
+func TestValidatePrefix(t *testing.T) {
+	validationErrors := Validate([]byte(`{
+  "target": {"address": "http://target:8200"},
+  "sources": {"s1": {"address": "http://source:8200"}},
+  "copies": [
+    {"prefix": "team-a", "secret": {"source": "s1", "prefix": "teams/a"}},
+    {"prefix": "team-b", "path": "p1", "secret": {"source": "s1"}},
+    {"prefix": "/", "secret": {"source": "s1", "path": "p2"}},
+    {"prefix": "team-c", "values": {"k": {"source": "s1"}}},
+    {"path": "p3", "secret": {"source": "s1", "prefix": "teams/d"}}
+  ]
+}`))
+
+	assert.Equal(t, []*ValidationError{
+		{Path: "$.copies[1].prefix", Line: 6, Message: "copy element cannot contain both path and prefix"},
+		{Path: "$.copies[2].prefix", Line: 7, Message: "prefix must designate a path within the KV secrets engine"},
+		{Path: "$.copies[2].secret.path", Line: 7, Message: "secret of a copy element with a prefix cannot contain a path"},
+		{Path: "$.copies[3].secret", Line: 8, Message: "copy element with a prefix must provide a secret"},
+		{Path: "$.copies[4].secret.prefix", Line: 9, Message: "secret prefix requires a copy element prefix"},
+	}, validationErrors)
+}
+
+func TestValidatePatterns(t *testing.T) {
+	validationErrors := Validate([]byte(`{
+  "target": {"address": "http://target:8200"},
+  "sources": {"s1": {"address": "http://source:8200"}},
+  "copies": [
+    {"prefix": "prod", "rewrite": "${1}/db", "secret": {"source": "s1", "prefix": "apps", "include": ["*/db", "^svc-(.*"], "exclude": ["[a-"]}},
+    {"path": "p1", "rewrite": "${1}", "secret": {"source": "s1"}},
+    {"path": "p2", "secret": {"source": "s1", "exclude": ["legacy/*"]}}
+  ]
+}`))
+
+	assert.Len(t, validationErrors, 4)
+	assert.Equal(t, "$.copies[0].secret.include[1]", validationErrors[0].Path)
+	assert.Equal(t, "$.copies[0].secret.exclude[0]", validationErrors[1].Path)
+	assert.Equal(t, &ValidationError{Path: "$.copies[1].rewrite", Line: 6, Message: "rewrite requires a copy element prefix"}, validationErrors[2])
+	assert.Equal(t, &ValidationError{Path: "$.copies[2].secret", Line: 7, Message: "include and exclude patterns require a copy element prefix"}, validationErrors[3])
+}
+
+func TestValidateMirror(t *testing.T) {
+	validationErrors := Validate([]byte(`{
+  "target": {"address": "http://target:8200"},
+  "sources": {"s1": {"address": "http://source:8200"}},
+  "copies": [
+    {"prefix": "team-a", "mirror": {}, "secret": {"source": "s1"}},
+    {"prefix": "team-b", "mirror": {"delete": "hard"}, "secret": {"source": "s1"}},
+    {"prefix": "team-c", "mirror": {"max-delete-percent": 101}, "secret": {"source": "s1"}},
+    {"path": "p1", "mirror": {}, "secret": {"source": "s1"}}
+  ]
+}`))
+
+	assert.Equal(t, []*ValidationError{
+		{Path: "$.copies[1].mirror", Line: 6, Message: `unsupported mirror delete mode "hard", expected soft or metadata`},
+		{Path: "$.copies[2].mirror", Line: 7, Message: "mirror max-delete-percent must be between 0 (default) and 100, got 101"},
+		{Path: "$.copies[3].mirror", Line: 8, Message: "mirror requires a copy element prefix"},
+	}, validationErrors)
+}
+
+func TestValidateMerge(t *testing.T) {
+	validationErrors := Validate([]byte(`{
+  "target": {"address": "http://target:8200"},
+  "sources": {"s1": {"address": "http://source:8200"}},
+  "copies": [
+    {"path": "p1", "merge": {"remove-unmapped": true}, "secret": {"source": "s1"}},
+    {"path": "p2", "kv-version": 1, "merge": {}, "secret": {"source": "s1"}},
+    {"path": "p3", "kv-version": 1, "merge": {"remove-unmapped": true}, "secret": {"source": "s1"}}
+  ]
+}`))
+
+	assert.Equal(t, []*ValidationError{
+		{Path: "$.copies[2].merge.remove-unmapped", Line: 7, Message: "remove-unmapped requires a KV version 2 target secret"},
+	}, validationErrors)
+}
+
+func TestValidateConflictRetries(t *testing.T) {
+	validationErrors := Validate([]byte(`{
+  "target": {"address": "http://target:8200"},
+  "sources": {"s1": {"address": "http://source:8200"}},
+  "copies": [
+    {"path": "p1", "conflict-retries": 3, "secret": {"source": "s1"}},
+    {"path": "p2", "conflict-retries": -1, "secret": {"source": "s1"}}
+  ]
+}`))
+
+	assert.Equal(t, []*ValidationError{
+		{Path: "$.copies[1].conflict-retries", Line: 6, Message: "conflict-retries cannot be negative"},
+	}, validationErrors)
+}
+
+func TestValidateUnexpandedLogin(t *testing.T) {
+	os.Unsetenv("HVC_VALIDATE_UNSET")
+
+	validationErrors := Validate([]byte(`{
+  "target": {"address": "http://target:8200", "login": {"token": "${HVC_VALIDATE_UNSET}"}},
+  "sources": {
+    "s1": {"address": "http://source:8200", "login": {"token-file": "${HVC_VALIDATE_UNSET}"}},
+    "s2": {"address": "http://source:8200", "login": {"token": "${HVC_VALIDATE_UNSET}", "token-file": "/token"}}
+  },
+  "copies": [{"path": "p1", "secret": {"source": "s1"}}]
+}`))
+
+	assert.Equal(t, []*ValidationError{
+		{Path: "$.target.login.token", Line: 2, Message: "environment variable HVC_VALIDATE_UNSET is not set"},
+		{Path: "$.sources.s1.login.token-file", Line: 4, Message: "environment variable HVC_VALIDATE_UNSET is not set"},
+		{Path: "$.sources.s2.login", Line: 5, Message: "only one login strategy can be specified"},
+		{Path: "$.sources.s2.login.token", Line: 5, Message: "environment variable HVC_VALIDATE_UNSET is not set"},
+	}, validationErrors)
+}
@@ -4,9 +4,22 @@ package spec
 // server and includes a VaultLogin structure to provide a login strategy.
 type Vault struct {
 	// Address contains the scheme, host, and port address of the Vault server.
-	Address string `json:"address"`
+	Address string `json:"address,omitempty"`
+
+	// Namespace contains the Vault Enterprise namespace in which the login
+	// operation and every request are performed.
+	Namespace string `json:"namespace,omitempty"`
+
+	// TLS is a VaultTLS object that provides the TLS settings used to connect
+	// to the Vault server.
+	TLS *VaultTLS `json:"tls,omitempty"`
 
 	// Login is a VaultLogin object that provides the details on how to obtain
 	// a valid Vault token.
-	Login *VaultLogin `json:"login"`
+	Login *VaultLogin `json:"login,omitempty"`
+
+	// KeepToken prevents the Vault token obtained by a login operation from
+	// being revoked once the copy job completes. Vault tokens provided to this
+	// application are never revoked.
+	KeepToken bool `json:"keep-token,omitempty"`
 }
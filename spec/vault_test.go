@@ -48,6 +48,44 @@ func TestVaultParseJSON(t *testing.T) {
 				},
 			},
 		},
+		// Valid JSON testcase with Login using AppRole method
+		{
+			json:            `{"address":"http://vault:8200","login":{"approle":{"role-id":"my-role-id","secret-id-file":"/home/secret-id","wrapped":true}}}`,
+			errorAssert:     assert.NoError,
+			expectedAddress: "http://vault:8200",
+			expectedLogin: &VaultLogin{
+				AppRole: &VaultAppRoleLogin{
+					RoleID:       "my-role-id",
+					SecretIDFile: "/home/secret-id",
+					Wrapped:      true,
+				},
+			},
+		},
+		// Valid JSON testcase with Login using JWT method
+		{
+			json:            `{"address":"http://vault:8200","login":{"jwt":{"mount-point":"github","role":"ci","jwt-env":"CI_JWT"}}}`,
+			errorAssert:     assert.NoError,
+			expectedAddress: "http://vault:8200",
+			expectedLogin: &VaultLogin{
+				JWT: &VaultJWTLogin{
+					MountPoint: "github",
+					Role:       "ci",
+					JWTEnv:     "CI_JWT",
+				},
+			},
+		},
+		// Valid JSON testcase with Login using LDAP method
+		{
+			json:            `{"address":"http://vault:8200","login":{"ldap":{"username":"alice","password-file":"/home/alice/.ldap-password"}}}`,
+			errorAssert:     assert.NoError,
+			expectedAddress: "http://vault:8200",
+			expectedLogin: &VaultLogin{
+				LDAP: &VaultPasswordLogin{
+					Username:     "alice",
+					PasswordFile: "/home/alice/.ldap-password",
+				},
+			},
+		},
 	} {
 		var v Vault
 
@@ -68,3 +106,17 @@ func TestVaultParseJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestVaultParseJSONWithTLS(t *testing.T) {
+	var v Vault
+
+	assert.NoError(t, json.NewDecoder(strings.NewReader(`{"address":"https://vault:8200","tls":{"ca-cert":"/etc/ca.pem","client-cert":"/etc/client.pem","client-key":"/etc/client-key.pem","server-name":"vault.internal","insecure":true},"login":{"cert":{"name":"hvc"}}}`)).Decode(&v))
+	assert.Equal(t, &VaultTLS{
+		CACert:     "/etc/ca.pem",
+		ClientCert: "/etc/client.pem",
+		ClientKey:  "/etc/client-key.pem",
+		ServerName: "vault.internal",
+		Insecure:   true,
+	}, v.TLS)
+	assert.Equal(t, &VaultCertLogin{Name: "hvc"}, v.Login.Cert)
+}
@@ -0,0 +1,25 @@
+package spec
+
+// VaultAppRoleLogin is a structure that specifies the details needed to
+// complete a Vault login operation using the AppRole authentication method.
+type VaultAppRoleLogin struct {
+	// MountPoint contains the path where the AppRole authentication method to
+	// use is mounted.
+	MountPoint string `json:"mount-point,omitempty"`
+
+	// RoleID contains the role ID of the backend role in the AppRole
+	// authentication method.
+	RoleID string `json:"role-id,omitempty"`
+
+	// SecretID contains the secret ID to use for the login operation. Only one
+	// of SecretID and SecretIDFile can be used.
+	SecretID string `json:"secret-id,omitempty"`
+
+	// SecretIDFile contains the local file-system path from which the secret ID
+	// is loaded. Only one of SecretID and SecretIDFile can be used.
+	SecretIDFile string `json:"secret-id-file,omitempty"`
+
+	// Wrapped indicates that the value provided by SecretID or SecretIDFile is
+	// a response wrapping token that must be unwrapped to obtain the secret ID.
+	Wrapped bool `json:"wrapped,omitempty"`
+}
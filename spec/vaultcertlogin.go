@@ -0,0 +1,16 @@
+package spec
+
+// VaultCertLogin is a structure that specifies the details needed to complete
+// a Vault login operation using the TLS Certificates authentication method.
+// The client certificate itself is specified in the TLS field of the Vault
+// structure.
+type VaultCertLogin struct {
+	// MountPoint contains the path where the TLS Certificates authentication
+	// method to use is mounted.
+	MountPoint string `json:"mount-point,omitempty"`
+
+	// Name contains the name of the certificate role to authenticate against.
+	// If omitted, Vault tries every certificate role that matches the client
+	// certificate.
+	Name string `json:"name,omitempty"`
+}
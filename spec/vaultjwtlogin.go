@@ -0,0 +1,21 @@
+package spec
+
+// VaultJWTLogin is a structure that specifies the details needed to complete a
+// Vault login operation using the JWT/OIDC authentication method.
+type VaultJWTLogin struct {
+	// MountPoint contains the path where the JWT authentication method to use
+	// is mounted.
+	MountPoint string `json:"mount-point,omitempty"`
+
+	// Role contains the name of the backend role in the JWT authentication
+	// method.
+	Role string `json:"role,omitempty"`
+
+	// JWTPath contains the local file-system path from which the signed JWT is
+	// loaded. Only one of JWTPath and JWTEnv can be used.
+	JWTPath string `json:"jwt-path,omitempty"`
+
+	// JWTEnv contains the name of the environment variable from which the
+	// signed JWT is loaded. Only one of JWTPath and JWTEnv can be used.
+	JWTEnv string `json:"jwt-env,omitempty"`
+}
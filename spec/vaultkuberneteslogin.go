@@ -5,13 +5,13 @@ package spec
 type VaultKubernetesLogin struct {
 	// MountPoint contains the path where the Kubernetes authentication method to
 	// use is mounted.
-	MountPoint string `json:"mount-point"`
+	MountPoint string `json:"mount-point,omitempty"`
 
 	// Role contains the name of the backend role in the Kubernetes authentication
 	// method.
-	Role string `json:"role"`
+	Role string `json:"role,omitempty"`
 
 	// JWTPath contains the local file-system path to use to load the Kubernetes
 	// Service Account key file.
-	JWTPath string `json:"jwt-path"`
+	JWTPath string `json:"jwt-path,omitempty"`
 }
@@ -1,12 +1,80 @@
 package spec
 
+import "errors"
+
 // VaultLogin is a structure that specifies the method to obtain a Vault token.
 // The structure contains multiple strategies, but only one should be used.
 type VaultLogin struct {
 	// Token contains a valid Vault token provided to this application.
-	Token string `json:"token"`
+	Token string `json:"token,omitempty"`
+	// TokenFile contains the local file-system path of a file containing a
+	// valid Vault token, such as the sink file written by a Vault Agent.
+	TokenFile string `json:"token-file,omitempty"`
 	// Kubernetes is a VaultKubernetesLogin object that specifies the details to
 	// complete a Vault login operation using the Kubernetes authentication
 	// method.
-	Kubernetes *VaultKubernetesLogin `json:"kubernetes"`
+	Kubernetes *VaultKubernetesLogin `json:"kubernetes,omitempty"`
+	// AppRole is a VaultAppRoleLogin object that specifies the details to
+	// complete a Vault login operation using the AppRole authentication method.
+	AppRole *VaultAppRoleLogin `json:"approle,omitempty"`
+	// JWT is a VaultJWTLogin object that specifies the details to complete a
+	// Vault login operation using the JWT/OIDC authentication method.
+	JWT *VaultJWTLogin `json:"jwt,omitempty"`
+	// Cert is a VaultCertLogin object that specifies the details to complete a
+	// Vault login operation using the TLS Certificates authentication method.
+	Cert *VaultCertLogin `json:"cert,omitempty"`
+	// Userpass is a VaultPasswordLogin object that specifies the details to
+	// complete a Vault login operation using the Userpass authentication
+	// method.
+	Userpass *VaultPasswordLogin `json:"userpass,omitempty"`
+	// LDAP is a VaultPasswordLogin object that specifies the details to
+	// complete a Vault login operation using the LDAP authentication method.
+	LDAP *VaultPasswordLogin `json:"ldap,omitempty"`
+}
+
+// Validate makes sure that exactly one login strategy is specified in the
+// receiver.
+func (p *VaultLogin) Validate() error {
+	count := 0
+
+	if p.Token != "" {
+		count++
+	}
+
+	if p.TokenFile != "" {
+		count++
+	}
+
+	if p.Kubernetes != nil {
+		count++
+	}
+
+	if p.AppRole != nil {
+		count++
+	}
+
+	if p.JWT != nil {
+		count++
+	}
+
+	if p.Cert != nil {
+		count++
+	}
+
+	if p.Userpass != nil {
+		count++
+	}
+
+	if p.LDAP != nil {
+		count++
+	}
+
+	switch {
+	case count == 0:
+		return errors.New("no login strategy specified")
+	case count > 1:
+		return errors.New("only one login strategy can be specified")
+	}
+
+	return nil
 }
@@ -0,0 +1,40 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultLoginValidate(t *testing.T) {
+	for _, testcase := range []struct {
+		login       *VaultLogin
+		errorAssert func(assert.TestingT, error, ...interface{}) bool
+	}{
+		// Token strategy
+		{
+			login:       &VaultLogin{Token: "root"},
+			errorAssert: assert.NoError,
+		},
+		// AppRole strategy
+		{
+			login:       &VaultLogin{AppRole: &VaultAppRoleLogin{RoleID: "r"}},
+			errorAssert: assert.NoError,
+		},
+		// No strategy
+		{
+			login:       &VaultLogin{},
+			errorAssert: assert.Error,
+		},
+		// Multiple strategies
+		{
+			login: &VaultLogin{
+				Token:   "root",
+				AppRole: &VaultAppRoleLogin{RoleID: "r"},
+			},
+			errorAssert: assert.Error,
+		},
+	} {
+		testcase.errorAssert(t, testcase.login.Validate())
+	}
+}
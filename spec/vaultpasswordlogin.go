@@ -0,0 +1,22 @@
+package spec
+
+// VaultPasswordLogin is a structure that specifies the details needed to
+// complete a Vault login operation using an authentication method that accepts
+// a username and password, such as the Userpass and LDAP authentication
+// methods.
+type VaultPasswordLogin struct {
+	// MountPoint contains the path where the authentication method to use is
+	// mounted.
+	MountPoint string `json:"mount-point,omitempty"`
+
+	// Username contains the name of the user to authenticate as.
+	Username string `json:"username,omitempty"`
+
+	// PasswordFile contains the local file-system path from which the password
+	// is loaded. Only one of PasswordFile and PasswordEnv can be used.
+	PasswordFile string `json:"password-file,omitempty"`
+
+	// PasswordEnv contains the name of the environment variable from which the
+	// password is loaded. Only one of PasswordFile and PasswordEnv can be used.
+	PasswordEnv string `json:"password-env,omitempty"`
+}
@@ -0,0 +1,29 @@
+package spec
+
+// VaultTLS is a structure that specifies the TLS settings used to establish
+// an API Client connection with a Vault server.
+type VaultTLS struct {
+	// CACert contains the local file-system path of a PEM-encoded CA
+	// certificate bundle used to verify the Vault server's certificate.
+	CACert string `json:"ca-cert,omitempty"`
+
+	// CAPath contains the local file-system path of a directory of PEM-encoded
+	// CA certificates used to verify the Vault server's certificate.
+	CAPath string `json:"ca-path,omitempty"`
+
+	// ClientCert contains the local file-system path of a PEM-encoded client
+	// certificate presented to the Vault server.
+	ClientCert string `json:"client-cert,omitempty"`
+
+	// ClientKey contains the local file-system path of the PEM-encoded private
+	// key that matches ClientCert.
+	ClientKey string `json:"client-key,omitempty"`
+
+	// ServerName contains the name used to set the SNI host when connecting to
+	// the Vault server.
+	ServerName string `json:"server-name,omitempty"`
+
+	// Insecure disables the verification of the Vault server's certificate.
+	// This should only be used in test environments.
+	Insecure bool `json:"insecure,omitempty"`
+}
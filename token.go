@@ -0,0 +1,210 @@
+package hvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// loginRetryInterval is the time waited before retrying a failed login
+// operation performed to replace a Vault token that can no longer be renewed.
+var loginRetryInterval = 10 * time.Second
+
+// login performs a login operation using the receiver's authMethod field and
+// sets the obtained Vault token in the client.
+func (p *realVault) login() (*vault.Secret, error) {
+	secret, err := p.client.Auth().Login(context.TODO(), p.authMethod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authentication with Vault server: %w", err)
+	}
+
+	return secret, nil
+}
+
+// watchToken keeps the Vault token obtained by a login operation valid. The
+// token is renewed for as long as it is renewable, and once it can no longer be
+// renewed, a new login operation is performed, the replaced token is revoked
+// and the new token is watched in turn. Tokens obtained by refreshToken are
+// received on the receiver's loginCh field and watched in place of the current
+// one. The function returns when the receiver is stopped.
+func (p *realVault) watchToken(secret *vault.Secret) {
+	for {
+		// A token that does not expire needs no renewal, but may still be
+		// replaced by refreshToken.
+		var watcher *vault.LifetimeWatcher
+		var doneCh <-chan error
+		if secret.Auth != nil && secret.Auth.LeaseDuration != 0 {
+			var err error
+			watcher, err = p.client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{
+				Secret: secret,
+			})
+			if err != nil {
+				return
+			}
+
+			go watcher.Start()
+			doneCh = watcher.DoneCh()
+		}
+
+		select {
+		case <-p.stopCh:
+			if watcher != nil {
+				watcher.Stop()
+			}
+			return
+		case secret = <-p.loginCh:
+			if watcher != nil {
+				watcher.Stop()
+			}
+			continue
+		case <-doneCh:
+		}
+
+		if secret = p.replaceToken(); secret == nil {
+			return
+		}
+	}
+}
+
+// replaceToken performs a new login operation to replace the Vault token that
+// can no longer be renewed and revokes the replaced token. The login operation
+// is retried until it succeeds or the receiver is stopped, in which case nil is
+// returned. If refreshToken already replaced the token, its new token is
+// returned instead.
+func (p *realVault) replaceToken() *vault.Secret {
+	for {
+		p.tokenMutex.Lock()
+
+		select {
+		case secret := <-p.loginCh:
+			p.tokenMutex.Unlock()
+			return secret
+		default:
+		}
+
+		token := p.client.Token()
+		secret, err := p.login()
+		if err == nil {
+			p.revokeReplacedToken(token)
+		}
+
+		p.tokenMutex.Unlock()
+
+		if err == nil {
+			return secret
+		}
+
+		select {
+		case <-p.stopCh:
+			return nil
+		case <-time.After(loginRetryInterval):
+		}
+	}
+}
+
+// stop stops the goroutine that renews the receiver's Vault token.
+func (p *realVault) stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
+}
+
+// loadTokenFile reads the Vault token from the receiver's tokenFile field and
+// sets it in the client. The function returns true if the token read differs
+// from the one previously set in the client.
+func (p *realVault) loadTokenFile() (bool, error) {
+	tokenBytes, err := ioutil.ReadFile(p.tokenFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read Vault token from file %s: %w", p.tokenFile, err)
+	}
+
+	token := strings.TrimSpace(string(tokenBytes))
+	if token == "" {
+		return false, fmt.Errorf("token file %s is empty", p.tokenFile)
+	}
+
+	if token == p.client.Token() {
+		return false, nil
+	}
+
+	p.client.SetToken(token)
+
+	return true, nil
+}
+
+// refreshToken determines if the provided error was caused by a permission
+// denied response to a request made with the provided token and if so,
+// obtains a new Vault token either by reloading the receiver's tokenFile or by
+// performing a new login operation. Since a permission denied response usually
+// means that a policy denied the request, a new login operation is only
+// performed once the token is confirmed to be invalid, the replaced token is
+// then revoked and the new token is handed to watchToken to be renewed. The
+// function returns true if a different token is now set in the client, meaning
+// that the failed request should be retried.
+func (p *realVault) refreshToken(token string, err error) bool {
+	if err == nil || (p.tokenFile == "" && p.authMethod == nil) {
+		return false
+	}
+
+	var responseError *vault.ResponseError
+	if !errors.As(err, &responseError) || responseError.StatusCode != http.StatusForbidden {
+		return false
+	}
+
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	// Another request may have already replaced the token.
+	if p.client.Token() != token {
+		return true
+	}
+
+	if p.tokenFile != "" {
+		reloaded, err := p.loadTokenFile()
+		return err == nil && reloaded
+	}
+
+	if _, err := p.client.Auth().Token().LookupSelf(); err == nil {
+		return false
+	}
+
+	secret, err := p.login()
+	if err != nil {
+		return false
+	}
+
+	p.revokeReplacedToken(token)
+
+	// Hand the new token to watchToken, replacing any token it did not
+	// receive yet.
+	select {
+	case <-p.loginCh:
+	default:
+	}
+	p.loginCh <- secret
+
+	return true
+}
+
+// revokeReplacedToken revokes the provided Vault token, which was replaced by
+// a new login operation, unless the receiver keeps its tokens. Since the token
+// is usually invalid already, failures are ignored.
+func (p *realVault) revokeReplacedToken(token string) {
+	if !p.revokeToken {
+		return
+	}
+
+	client, err := p.client.Clone()
+	if err != nil {
+		return
+	}
+
+	client.SetToken(token)
+	client.Auth().Token().RevokeSelf("")
+}
@@ -0,0 +1,270 @@
+package hvc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/marcboudreau/hvc/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchTokenRenewsAndLogsInAgain(t *testing.T) {
+	var logins, renewals int32
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/jwt/login": func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&logins, 1)
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Auth: &vaultapi.SecretAuth{
+					ClientToken:   fmt.Sprintf("token-%d", n),
+					Renewable:     true,
+					LeaseDuration: 1,
+				},
+			})
+		},
+		// The renewal reports that the token's max TTL was reached.
+		"/v1/auth/token/renew-self": func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&renewals, 1)
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Auth: &vaultapi.SecretAuth{
+					ClientToken:   r.Header.Get("X-Vault-Token"),
+					Renewable:     true,
+					LeaseDuration: 0,
+				},
+			})
+		},
+	})
+
+	os.Setenv("HVC_TEST_JWT", "my-jwt")
+	defer os.Unsetenv("HVC_TEST_JWT")
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			JWT: &spec.VaultJWTLogin{
+				Role:   "my-role",
+				JWTEnv: "HVC_TEST_JWT",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	defer vault.(*realVault).stop()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&renewals) >= 1 && atomic.LoadInt32(&logins) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotEqual(t, "token-1", vault.(*realVault).client.Token())
+}
+
+func TestRefreshTokenLogsInAgainWhenDenied(t *testing.T) {
+	var logins int32
+	revoked := make(chan string, 1)
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/jwt/login": func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&logins, 1)
+			LoginHandler(nil, fmt.Sprintf("token-%d", n))(w, r)
+		},
+		// The first token expired.
+		"/v1/auth/token/lookup-self": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		},
+		"/v1/auth/token/revoke-self": func(w http.ResponseWriter, r *http.Request) {
+			revoked <- r.Header.Get("X-Vault-Token")
+			w.WriteHeader(http.StatusNoContent)
+		},
+		"/v1/kv/data/p1": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") == "token-1" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"errors":["permission denied"]}`)
+				return
+			}
+
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Data: map[string]interface{}{"k1": "v1"},
+			})
+		},
+	})
+
+	os.Setenv("HVC_TEST_JWT", "my-jwt")
+	defer os.Unsetenv("HVC_TEST_JWT")
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			JWT: &spec.VaultJWTLogin{
+				Role:   "my-role",
+				JWTEnv: "HVC_TEST_JWT",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	defer vault.(*realVault).stop()
+
+	secret, err := vault.Read("kv/data/p1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", secret.Data["k1"])
+	assert.Equal(t, int32(2), atomic.LoadInt32(&logins))
+	assert.Equal(t, "token-1", <-revoked)
+}
+
+func TestRefreshTokenHandsNewTokenToWatcher(t *testing.T) {
+	var logins int32
+	var mutex sync.Mutex
+	var renewed, revoked []string
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/jwt/login": func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&logins, 1)
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Auth: &vaultapi.SecretAuth{
+					ClientToken:   fmt.Sprintf("token-%d", n),
+					Renewable:     true,
+					LeaseDuration: 3600,
+				},
+			})
+		},
+		// Only the renewal of the token obtained after the denied request
+		// reports that the token's max TTL was reached.
+		"/v1/auth/token/renew-self": func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get("X-Vault-Token")
+
+			mutex.Lock()
+			renewed = append(renewed, token)
+			mutex.Unlock()
+
+			leaseDuration := 3600
+			if token == "token-2" {
+				leaseDuration = 0
+			}
+
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Auth: &vaultapi.SecretAuth{
+					ClientToken:   token,
+					Renewable:     true,
+					LeaseDuration: leaseDuration,
+				},
+			})
+		},
+		// The first token was invalidated.
+		"/v1/auth/token/lookup-self": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		},
+		"/v1/auth/token/revoke-self": func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			revoked = append(revoked, r.Header.Get("X-Vault-Token"))
+			mutex.Unlock()
+
+			w.WriteHeader(http.StatusNoContent)
+		},
+		"/v1/kv/data/p1": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") == "token-1" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"errors":["permission denied"]}`)
+				return
+			}
+
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Data: map[string]interface{}{"k1": "v1"},
+			})
+		},
+	})
+
+	os.Setenv("HVC_TEST_JWT", "my-jwt")
+	defer os.Unsetenv("HVC_TEST_JWT")
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			JWT: &spec.VaultJWTLogin{
+				Role:   "my-role",
+				JWTEnv: "HVC_TEST_JWT",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	defer vault.(*realVault).stop()
+
+	_, err = vault.Read("kv/data/p1")
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&logins) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	vault.(*realVault).tokenMutex.Lock()
+	assert.Equal(t, "token-3", vault.(*realVault).client.Token())
+	vault.(*realVault).tokenMutex.Unlock()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Contains(t, renewed, "token-2")
+	assert.Equal(t, []string{"token-1", "token-2"}, revoked)
+}
+
+func TestRefreshTokenKeepsValidTokenWhenDenied(t *testing.T) {
+	var logins int32
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/jwt/login": func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&logins, 1)
+			LoginHandler(nil, fmt.Sprintf("token-%d", n))(w, r)
+		},
+		// The token is valid, but a policy denies the request.
+		"/v1/auth/token/lookup-self": func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Data: map[string]interface{}{"id": r.Header.Get("X-Vault-Token")},
+			})
+		},
+		"/v1/kv/data/p1": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		},
+	})
+
+	os.Setenv("HVC_TEST_JWT", "my-jwt")
+	defer os.Unsetenv("HVC_TEST_JWT")
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			JWT: &spec.VaultJWTLogin{
+				Role:   "my-role",
+				JWTEnv: "HVC_TEST_JWT",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	defer vault.(*realVault).stop()
+
+	_, err = vault.Read("kv/data/p1")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&logins))
+	assert.Equal(t, "token-1", vault.(*realVault).client.Token())
+}
+
+func TestRefreshTokenIgnoresUserProvidedToken(t *testing.T) {
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/kv/data/p1": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+		},
+	})
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			Token: "root",
+		},
+	}, "test")
+	assert.NoError(t, err)
+
+	_, err = vault.Read("kv/data/p1")
+	assert.Error(t, err)
+	assert.Equal(t, "root", vault.(*realVault).client.Token())
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 
 	vault "github.com/hashicorp/vault/api"
-	k8sauth "github.com/hashicorp/vault/api/auth/kubernetes"
 	"github.com/marcboudreau/hvc/spec"
 )
 
@@ -15,7 +17,12 @@ import (
 type Vault interface {
 	Name() string
 	Read(string) (*vault.Secret, error)
+	List(string) (*vault.Secret, error)
+	Delete(string) (*vault.Secret, error)
+	Patch(string, map[string]interface{}) (*vault.Secret, error)
 	Write(string, map[string]interface{}) (*vault.Secret, error)
+	Close() error
+	WithNamespace(string) (Vault, error)
 }
 
 // realVault is an object that creates an API Client connection to a real
@@ -25,13 +32,57 @@ type realVault struct {
 
 	name   string
 	client *vault.Client
+
+	// tokenFile is the path of the file from which the Vault token is loaded,
+	// when the token is provided by a file rather than a login operation.
+	tokenFile string
+
+	// authMethod is the vault.AuthMethod used to obtain the Vault token, when
+	// the token is obtained by a login operation.
+	authMethod vault.AuthMethod
+
+	// tokenMutex serializes the operations that replace the Vault token.
+	tokenMutex sync.Mutex
+
+	// revokeToken indicates whether the Vault token obtained by a login
+	// operation is revoked when the receiver is closed.
+	revokeToken bool
+
+	// loginCh carries the Vault tokens obtained by refreshToken to the
+	// goroutine that renews the Vault token.
+	loginCh chan *vault.Secret
+
+	// stopCh is closed to stop the goroutine that renews the Vault token.
+	stopCh   chan struct{}
+	stopOnce sync.Once
 }
 
 // NewVault creates a Vault connection using the provided spec.Vault object.
 // This function creates the API Client object and then resolves the contained
 // VaultLogin object to obtain a valid Vault token and sets it in the client.
+// If the spec.Vault object contains a VaultTLS object, its settings are
+// applied to the client's TLS configuration.
 func NewVault(spec *spec.Vault, name string) (Vault, error) {
-	vaultClient, err := vault.NewClient(nil)
+	config := vault.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+
+	if spec.TLS != nil {
+		err := config.ConfigureTLS(&vault.TLSConfig{
+			CACert:        spec.TLS.CACert,
+			CAPath:        spec.TLS.CAPath,
+			ClientCert:    spec.TLS.ClientCert,
+			ClientKey:     spec.TLS.ClientKey,
+			TLSServerName: spec.TLS.ServerName,
+			Insecure:      spec.TLS.Insecure,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+	}
+
+	vaultClient, err := vault.NewClient(config)
 	if err != nil {
 		return nil, err
 	}
@@ -40,32 +91,60 @@ func NewVault(spec *spec.Vault, name string) (Vault, error) {
 		vaultClient.SetAddress(spec.Address)
 	}
 
+	if spec.Namespace != "" {
+		vaultClient.SetNamespace(spec.Namespace)
+	}
+
+	realVault := &realVault{
+		client:  vaultClient,
+		name:    name,
+		loginCh: make(chan *vault.Secret, 1),
+		stopCh:  make(chan struct{}),
+	}
+
 	if spec.Login != nil {
-		if spec.Login.Token != "" {
+		if err := spec.Login.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid login specification: %w", err)
+		}
+
+		if spec.Login.Cert != nil && (spec.TLS == nil || spec.TLS.ClientCert == "") {
+			return nil, errors.New("cert login strategy requires a client certificate in the tls section")
+		}
+
+		switch {
+		case spec.Login.Token != "":
 			vaultClient.SetToken(spec.Login.Token)
-		} else if spec.Login.Kubernetes != nil {
-			kubernetesMountPoint := "kubernetes"
-			if spec.Login.Kubernetes.MountPoint != "" {
-				kubernetesMountPoint = spec.Login.Kubernetes.MountPoint
+		case spec.Login.TokenFile != "":
+			realVault.tokenFile = spec.Login.TokenFile
+			if _, err := realVault.loadTokenFile(); err != nil {
+				return nil, err
 			}
-
-			jwtPath := "/var/run/secrets/kubernetes.io/serviceaccount/token"
-			if spec.Login.Kubernetes.JWTPath != "" {
-				jwtPath = spec.Login.Kubernetes.JWTPath
+		default:
+			authMethod, err := newAuthMethod(spec.Login)
+			if err != nil {
+				return nil, err
 			}
 
-			auth, err := k8sauth.NewKubernetesAuth(
-				spec.Login.Kubernetes.Role,
-				k8sauth.WithServiceAccountTokenPath(jwtPath),
-				k8sauth.WithMountPath(kubernetesMountPoint),
-			)
+			realVault.authMethod = authMethod
+			realVault.revokeToken = !spec.KeepToken
+
+			secret, err := realVault.login()
 			if err != nil {
-				return nil, fmt.Errorf("failed to initialize Kubernetes authentication method: %w", err)
+				return nil, err
 			}
 
-			_, err = vaultClient.Auth().Login(context.TODO(), auth)
-			if err != nil {
-				return nil, fmt.Errorf("failed to authentication with Vault server: %w", err)
+			go realVault.watchToken(secret)
+		}
+	} else if vaultClient.Token() == "" {
+		// Fall back on the token file used by the Vault CLI, when neither a
+		// login strategy nor the VAULT_TOKEN environment variable is provided.
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			tokenFile := filepath.Join(homeDir, ".vault-token")
+			if _, err := os.Stat(tokenFile); err == nil {
+				realVault.tokenFile = tokenFile
+				if _, err := realVault.loadTokenFile(); err != nil {
+					return nil, err
+				}
 			}
 		}
 	}
@@ -74,10 +153,7 @@ func NewVault(spec *spec.Vault, name string) (Vault, error) {
 		return nil, errors.New("no Vault token obtained")
 	}
 
-	return &realVault{
-		client: vaultClient,
-		name:   name,
-	}, nil
+	return realVault, nil
 }
 
 func (p *realVault) Name() string {
@@ -87,11 +163,166 @@ func (p *realVault) Name() string {
 // Read uses the receiver's client field to dispatch a corresponding Read
 // call.
 func (p *realVault) Read(path string) (*vault.Secret, error) {
-	return p.client.Logical().Read(path)
+	return p.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().Read(path)
+	})
+}
+
+// List uses the receiver's client field to dispatch a corresponding List
+// call.
+func (p *realVault) List(path string) (*vault.Secret, error) {
+	return p.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().List(path)
+	})
+}
+
+// Delete uses the receiver's client field to dispatch a corresponding Delete
+// call.
+func (p *realVault) Delete(path string) (*vault.Secret, error) {
+	return p.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().Delete(path)
+	})
+}
+
+// Patch uses the receiver's client field to dispatch a corresponding JSON
+// merge patch call.
+func (p *realVault) Patch(path string, data map[string]interface{}) (*vault.Secret, error) {
+	return p.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().JSONMergePatch(context.Background(), path, data)
+	})
 }
 
 // Write uses the receiver's client field to dispatch a corresponding Write
 // call.
 func (p *realVault) Write(path string, data map[string]interface{}) (*vault.Secret, error) {
-	return p.client.Logical().Write(path, data)
+	return p.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().Write(path, data)
+	})
+}
+
+// WithNamespace returns a Vault interface that shares the receiver's Vault
+// token, but dispatches its calls in the provided Vault Enterprise namespace.
+func (p *realVault) WithNamespace(namespace string) (Vault, error) {
+	client, err := p.client.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for namespace %s of %s: %w", namespace, p.name, err)
+	}
+
+	client.SetNamespace(namespace)
+
+	return &namespacedVault{
+		parent:    p,
+		client:    client,
+		namespace: namespace,
+	}, nil
+}
+
+// dispatch invokes the provided operation with the provided client, after
+// setting the receiver's Vault token in it. If the operation is denied and a
+// new Vault token can be obtained, the operation is retried with the new
+// token.
+func (p *realVault) dispatch(client *vault.Client, operation func(*vault.Client) (*vault.Secret, error)) (*vault.Secret, error) {
+	token := p.client.Token()
+	if client != p.client {
+		client.SetToken(token)
+	}
+
+	secret, err := operation(client)
+	if p.refreshToken(token, err) {
+		if client != p.client {
+			client.SetToken(p.client.Token())
+		}
+
+		return operation(client)
+	}
+
+	return secret, err
+}
+
+// Close stops the renewal of the receiver's Vault token and, if the token was
+// obtained by a login operation performed by this application, revokes it.
+// Vault tokens provided to this application are never revoked.
+func (p *realVault) Close() error {
+	p.stop()
+
+	if p.authMethod == nil || !p.revokeToken {
+		return nil
+	}
+
+	p.tokenMutex.Lock()
+	defer p.tokenMutex.Unlock()
+
+	if err := p.client.Auth().Token().RevokeSelf(""); err != nil {
+		return fmt.Errorf("failed to revoke Vault token of %s: %w", p.name, err)
+	}
+
+	return nil
+}
+
+// namespacedVault is an object that dispatches calls to a real Vault server in
+// a specific Vault Enterprise namespace, using the Vault token of its parent
+// realVault.
+type namespacedVault struct {
+	Vault
+
+	parent    *realVault
+	client    *vault.Client
+	namespace string
+}
+
+// Name returns the name of the receiver's parent, qualified with its
+// namespace.
+func (p *namespacedVault) Name() string {
+	return fmt.Sprintf("%s[%s]", p.parent.name, p.namespace)
+}
+
+// Read uses the receiver's client field to dispatch a corresponding Read
+// call.
+func (p *namespacedVault) Read(path string) (*vault.Secret, error) {
+	return p.parent.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().Read(path)
+	})
+}
+
+// List uses the receiver's client field to dispatch a corresponding List
+// call.
+func (p *namespacedVault) List(path string) (*vault.Secret, error) {
+	return p.parent.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().List(path)
+	})
+}
+
+// Delete uses the receiver's client field to dispatch a corresponding Delete
+// call.
+func (p *namespacedVault) Delete(path string) (*vault.Secret, error) {
+	return p.parent.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().Delete(path)
+	})
+}
+
+// Patch uses the receiver's client field to dispatch a corresponding JSON
+// merge patch call.
+func (p *namespacedVault) Patch(path string, data map[string]interface{}) (*vault.Secret, error) {
+	return p.parent.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().JSONMergePatch(context.Background(), path, data)
+	})
+}
+
+// Write uses the receiver's client field to dispatch a corresponding Write
+// call.
+func (p *namespacedVault) Write(path string, data map[string]interface{}) (*vault.Secret, error) {
+	return p.parent.dispatch(p.client, func(client *vault.Client) (*vault.Secret, error) {
+		return client.Logical().Write(path, data)
+	})
+}
+
+// WithNamespace returns a Vault interface that dispatches its calls in the
+// provided namespace instead of the receiver's.
+func (p *namespacedVault) WithNamespace(namespace string) (Vault, error) {
+	return p.parent.WithNamespace(namespace)
+}
+
+// Close does nothing since the Vault token belongs to the receiver's parent.
+func (p *namespacedVault) Close() error {
+	return nil
 }
@@ -1,8 +1,19 @@
 package hvc
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/marcboudreau/hvc/spec"
 	"github.com/stretchr/testify/assert"
 )
@@ -48,6 +59,281 @@ func TestNewVault(t *testing.T) {
 	}
 }
 
+func TestNewVaultAppRoleLogin(t *testing.T) {
+	request := make(map[string]interface{})
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/my-approle/login": LoginHandler(request, "approle-token"),
+	})
+
+	secretIDFile := filepath.Join(t.TempDir(), "secret-id")
+	assert.NoError(t, ioutil.WriteFile(secretIDFile, []byte("my-secret-id\n"), 0600))
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			AppRole: &spec.VaultAppRoleLogin{
+				MountPoint:   "my-approle",
+				RoleID:       "my-role-id",
+				SecretIDFile: secretIDFile,
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.NotNil(t, vault)
+	assert.Equal(t, "approle-token", vault.(*realVault).client.Token())
+	assert.Equal(t, "my-role-id", request["role_id"])
+	assert.Equal(t, "my-secret-id", request["secret_id"])
+}
+
+func TestNewVaultJWTLogin(t *testing.T) {
+	request := make(map[string]interface{})
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/jwt/login": LoginHandler(request, "jwt-token"),
+	})
+
+	os.Setenv("HVC_TEST_JWT", "my-jwt")
+	defer os.Unsetenv("HVC_TEST_JWT")
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			JWT: &spec.VaultJWTLogin{
+				Role:   "my-role",
+				JWTEnv: "HVC_TEST_JWT",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.NotNil(t, vault)
+	assert.Equal(t, "jwt-token", vault.(*realVault).client.Token())
+	assert.Equal(t, "my-role", request["role"])
+	assert.Equal(t, "my-jwt", request["jwt"])
+}
+
+func TestNewVaultJWTLoginRequiresOneJWTSource(t *testing.T) {
+	vault, err := NewVault(&spec.Vault{
+		Address: "http://localhost:8200",
+		Login: &spec.VaultLogin{
+			JWT: &spec.VaultJWTLogin{
+				Role:    "my-role",
+				JWTPath: "/home/jwt",
+				JWTEnv:  "HVC_TEST_JWT",
+			},
+		},
+	}, "test")
+	assert.Error(t, err)
+	assert.Nil(t, vault)
+}
+
+func TestNewVaultTLSCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&vaultapi.Secret{
+			Data: map[string]interface{}{"k1": "v1"},
+		})
+	}))
+	defer server.Close()
+
+	caCertFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NoError(t, ioutil.WriteFile(caCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		TLS: &spec.VaultTLS{
+			CACert: caCertFile,
+		},
+		Login: &spec.VaultLogin{
+			Token: "root",
+		},
+	}, "test")
+	assert.NoError(t, err)
+
+	secret, err := vault.Read("kv/data/p1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", secret.Data["k1"])
+}
+
+func TestNewVaultCertLogin(t *testing.T) {
+	var peerCertificates int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCertificates = len(r.TLS.PeerCertificates)
+		LoginHandler(nil, "cert-token")(w, r)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	certFile, keyFile := WriteClientCertificate(t)
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		TLS: &spec.VaultTLS{
+			ClientCert: certFile,
+			ClientKey:  keyFile,
+			Insecure:   true,
+		},
+		Login: &spec.VaultLogin{
+			Cert: &spec.VaultCertLogin{},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.NotNil(t, vault)
+	assert.Equal(t, "cert-token", vault.(*realVault).client.Token())
+	assert.Equal(t, 1, peerCertificates)
+}
+
+func TestNewVaultCertLoginRequiresClientCert(t *testing.T) {
+	vault, err := NewVault(&spec.Vault{
+		Address: "https://localhost:8200",
+		Login: &spec.VaultLogin{
+			Cert: &spec.VaultCertLogin{},
+		},
+	}, "test")
+	assert.Error(t, err)
+	assert.Nil(t, vault)
+}
+
+func TestNewVaultPasswordLogin(t *testing.T) {
+	userpassRequest := make(map[string]interface{})
+	ldapRequest := make(map[string]interface{})
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/userpass/login/alice": LoginHandler(userpassRequest, "userpass-token"),
+		"/v1/auth/corp-ldap/login/bob":  LoginHandler(ldapRequest, "ldap-token"),
+	})
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, ioutil.WriteFile(passwordFile, []byte("alice-password\n"), 0600))
+
+	os.Setenv("HVC_TEST_PASSWORD", "bob-password")
+	defer os.Unsetenv("HVC_TEST_PASSWORD")
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			Userpass: &spec.VaultPasswordLogin{
+				Username:     "alice",
+				PasswordFile: passwordFile,
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "userpass-token", vault.(*realVault).client.Token())
+	assert.Equal(t, "alice-password", userpassRequest["password"])
+
+	vault, err = NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			LDAP: &spec.VaultPasswordLogin{
+				MountPoint:  "corp-ldap",
+				Username:    "bob",
+				PasswordEnv: "HVC_TEST_PASSWORD",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "ldap-token", vault.(*realVault).client.Token())
+	assert.Equal(t, "bob-password", ldapRequest["password"])
+}
+
+func TestNewVaultPasswordLoginErrorOmitsPassword(t *testing.T) {
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/userpass/login/alice": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":["invalid password s3cr3t-p4ss"]}`)
+		},
+	})
+
+	os.Setenv("HVC_TEST_PASSWORD", "s3cr3t-p4ss")
+	defer os.Unsetenv("HVC_TEST_PASSWORD")
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			Userpass: &spec.VaultPasswordLogin{
+				Username:    "alice",
+				PasswordEnv: "HVC_TEST_PASSWORD",
+			},
+		},
+	}, "test")
+	assert.Error(t, err)
+	assert.Nil(t, vault)
+	assert.NotContains(t, err.Error(), "s3cr3t-p4ss")
+	assert.Contains(t, err.Error(), "invalid password <redacted>")
+
+	var responseError *vaultapi.ResponseError
+	if assert.True(t, errors.As(err, &responseError)) {
+		assert.Equal(t, http.StatusBadRequest, responseError.StatusCode)
+	}
+}
+
+func TestNewVaultRejectsMultipleLoginStrategies(t *testing.T) {
+	vault, err := NewVault(&spec.Vault{
+		Address: "http://localhost:8200",
+		Login: &spec.VaultLogin{
+			Token: "root",
+			AppRole: &spec.VaultAppRoleLogin{
+				RoleID:   "my-role-id",
+				SecretID: "my-secret-id",
+			},
+		},
+	}, "test")
+	assert.Error(t, err)
+	assert.Nil(t, vault)
+}
+
+func TestNewVaultTokenFileReloadedWhenDenied(t *testing.T) {
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/kv/data/p1": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != "rotated-token" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"errors":["permission denied"]}`)
+				return
+			}
+
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Data: map[string]interface{}{"k1": "v1"},
+			})
+		},
+	})
+
+	tokenFile := filepath.Join(t.TempDir(), "sink")
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("initial-token\n"), 0600))
+
+	vault, err := NewVault(&spec.Vault{
+		Address: server.URL,
+		Login: &spec.VaultLogin{
+			TokenFile: tokenFile,
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "initial-token", vault.(*realVault).client.Token())
+
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("rotated-token\n"), 0600))
+
+	secret, err := vault.Read("kv/data/p1")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", secret.Data["k1"])
+	assert.Equal(t, "rotated-token", vault.(*realVault).client.Token())
+}
+
+func TestNewVaultFallsBackOnVaultTokenFile(t *testing.T) {
+	homeDir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(homeDir, ".vault-token"), []byte("cli-token"), 0600))
+
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", homeDir)
+
+	if token, found := os.LookupEnv("VAULT_TOKEN"); found {
+		defer os.Setenv("VAULT_TOKEN", token)
+		os.Unsetenv("VAULT_TOKEN")
+	}
+
+	vault, err := NewVault(&spec.Vault{
+		Address: "http://localhost:8200",
+	}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "cli-token", vault.(*realVault).client.Token())
+}
+
 func TestVaultName(t *testing.T) {
 	vault, err := NewVault(&spec.Vault{
 		Address: "http://localhost:8200",
@@ -84,3 +370,113 @@ func TestNewVaultHandlesDefault(t *testing.T) {
 		assert.Equal(t, testcase.expectedAddress, vault.(*realVault).client.Address())
 	}
 }
+
+func TestVaultCloseRevokesOnlyObtainedTokens(t *testing.T) {
+	var revoked []string
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/userpass/login/alice": LoginHandler(nil, "userpass-token"),
+		"/v1/auth/token/revoke-self": func(w http.ResponseWriter, r *http.Request) {
+			revoked = append(revoked, r.Header.Get("X-Vault-Token"))
+			w.WriteHeader(http.StatusNoContent)
+		},
+	})
+
+	os.Setenv("HVC_TEST_PASSWORD", "alice-password")
+	defer os.Unsetenv("HVC_TEST_PASSWORD")
+
+	for _, testcase := range []struct {
+		spec            *spec.Vault
+		expectedRevoked []string
+	}{
+		// Token obtained by a login operation
+		{
+			spec: &spec.Vault{
+				Address: server.URL,
+				Login: &spec.VaultLogin{
+					Userpass: &spec.VaultPasswordLogin{
+						Username:    "alice",
+						PasswordEnv: "HVC_TEST_PASSWORD",
+					},
+				},
+			},
+			expectedRevoked: []string{"userpass-token"},
+		},
+		// Token obtained by a login operation, but kept
+		{
+			spec: &spec.Vault{
+				Address: server.URL,
+				Login: &spec.VaultLogin{
+					Userpass: &spec.VaultPasswordLogin{
+						Username:    "alice",
+						PasswordEnv: "HVC_TEST_PASSWORD",
+					},
+				},
+				KeepToken: true,
+			},
+		},
+		// Token provided by the user
+		{
+			spec: &spec.Vault{
+				Address: server.URL,
+				Login: &spec.VaultLogin{
+					Token: "root",
+				},
+			},
+		},
+	} {
+		revoked = nil
+
+		vault, err := NewVault(testcase.spec, "test")
+		assert.NoError(t, err)
+		assert.NoError(t, vault.Close())
+		assert.Equal(t, testcase.expectedRevoked, revoked)
+	}
+}
+
+func TestNewVaultNamespace(t *testing.T) {
+	namespaces := make(map[string]string)
+	recordNamespace := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			namespaces[r.URL.Path] = r.Header.Get("X-Vault-Namespace")
+			handler(w, r)
+		}
+	}
+
+	server := NewFakeVaultServer(t, map[string]http.HandlerFunc{
+		"/v1/auth/jwt/login": recordNamespace(LoginHandler(nil, "jwt-token")),
+		"/v1/kv/data/p1": recordNamespace(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(&vaultapi.Secret{
+				Data: map[string]interface{}{"token": r.Header.Get("X-Vault-Token")},
+			})
+		}),
+	})
+
+	os.Setenv("HVC_TEST_JWT", "my-jwt")
+	defer os.Unsetenv("HVC_TEST_JWT")
+
+	vault, err := NewVault(&spec.Vault{
+		Address:   server.URL,
+		Namespace: "team-a",
+		Login: &spec.VaultLogin{
+			JWT: &spec.VaultJWTLogin{
+				Role:   "my-role",
+				JWTEnv: "HVC_TEST_JWT",
+			},
+		},
+	}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", namespaces["/v1/auth/jwt/login"])
+
+	_, err = vault.Read("kv/data/p1")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", namespaces["/v1/kv/data/p1"])
+
+	namespacedVault, err := vault.WithNamespace("team-a/child")
+	assert.NoError(t, err)
+	assert.Equal(t, "test[team-a/child]", namespacedVault.Name())
+
+	secret, err := namespacedVault.Read("kv/data/p1")
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a/child", namespaces["/v1/kv/data/p1"])
+	assert.Equal(t, "jwt-token", secret.Data["token"])
+}
@@ -1,7 +1,21 @@
 package hvc
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
 
 	vault "github.com/hashicorp/vault/api"
 )
@@ -9,9 +23,24 @@ import (
 type FakeVault struct {
 	Vault
 
-	name           string
-	readResponses  []FakeVaultResponse
-	writeResponses []FakeVaultResponse
+	name            string
+	readResponses   []FakeVaultResponse
+	writeResponses  []FakeVaultResponse
+	listResponses   []FakeVaultResponse
+	deleteResponses []FakeVaultResponse
+	patchResponses  []FakeVaultResponse
+	closed          bool
+	namespace       string
+	reads           []string
+	lists           []string
+	deletes         []string
+	writes          []FakeVaultWrite
+	patches         []FakeVaultWrite
+}
+
+type FakeVaultWrite struct {
+	path string
+	data map[string]interface{}
 }
 
 type FakeVaultResponse struct {
@@ -24,13 +53,39 @@ func (p *FakeVault) InitializeClient() error {
 }
 
 func (p *FakeVault) Read(path string) (*vault.Secret, error) {
+	p.reads = append(p.reads, path)
 	response := p.readResponses[0]
 	p.readResponses = p.readResponses[1:]
 
 	return response.secret, response.err
 }
 
+func (p *FakeVault) List(path string) (*vault.Secret, error) {
+	p.lists = append(p.lists, path)
+	response := p.listResponses[0]
+	p.listResponses = p.listResponses[1:]
+
+	return response.secret, response.err
+}
+
+func (p *FakeVault) Delete(path string) (*vault.Secret, error) {
+	p.deletes = append(p.deletes, path)
+	response := p.deleteResponses[0]
+	p.deleteResponses = p.deleteResponses[1:]
+
+	return response.secret, response.err
+}
+
+func (p *FakeVault) Patch(path string, data map[string]interface{}) (*vault.Secret, error) {
+	p.patches = append(p.patches, FakeVaultWrite{path: path, data: data})
+	response := p.patchResponses[0]
+	p.patchResponses = p.patchResponses[1:]
+
+	return response.secret, response.err
+}
+
 func (p *FakeVault) Write(path string, data map[string]interface{}) (*vault.Secret, error) {
+	p.writes = append(p.writes, FakeVaultWrite{path: path, data: data})
 	response := p.writeResponses[0]
 	p.writeResponses = p.writeResponses[1:]
 
@@ -41,6 +96,16 @@ func (p *FakeVault) Name() string {
 	return p.name
 }
 
+func (p *FakeVault) WithNamespace(namespace string) (Vault, error) {
+	p.namespace = namespace
+	return p, nil
+}
+
+func (p *FakeVault) Close() error {
+	p.closed = true
+	return nil
+}
+
 type UninitializableVault struct {
 	name string
 }
@@ -53,6 +118,18 @@ func (p *UninitializableVault) Read(path string) (*vault.Secret, error) {
 	return nil, nil
 }
 
+func (p *UninitializableVault) List(path string) (*vault.Secret, error) {
+	return nil, nil
+}
+
+func (p *UninitializableVault) Delete(path string) (*vault.Secret, error) {
+	return nil, nil
+}
+
+func (p *UninitializableVault) Patch(path string, data map[string]interface{}) (*vault.Secret, error) {
+	return nil, nil
+}
+
 func (p *UninitializableVault) Write(path string, data map[string]interface{}) (*vault.Secret, error) {
 	return nil, nil
 }
@@ -60,3 +137,84 @@ func (p *UninitializableVault) Write(path string, data map[string]interface{}) (
 func (p *UninitializableVault) Name() string {
 	return p.name
 }
+
+func (p *UninitializableVault) WithNamespace(namespace string) (Vault, error) {
+	return p, nil
+}
+
+func (p *UninitializableVault) Close() error {
+	return nil
+}
+
+// NewFakeVaultServer starts an HTTP server that dispatches requests to the
+// handlers registered in the provided map of paths. The server is closed when
+// the test completes.
+func NewFakeVaultServer(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	for path, handler := range handlers {
+		mux.HandleFunc(path, handler)
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// LoginHandler returns an http.HandlerFunc that decodes the login request
+// body into the provided map and responds with the provided client token.
+func LoginHandler(request map[string]interface{}, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if request != nil {
+			json.NewDecoder(r.Body).Decode(&request)
+		}
+
+		json.NewEncoder(w).Encode(&vault.Secret{
+			Auth: &vault.SecretAuth{
+				ClientToken: token,
+			},
+		})
+	}
+}
+
+// WriteClientCertificate generates a self-signed client certificate and its
+// private key and writes them as PEM-encoded files in a temporary directory.
+// The paths of the certificate and key files are returned.
+func WriteClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hvc"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
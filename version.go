@@ -0,0 +1,123 @@
+package hvc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// fingerprintKeySize is the size in bytes of the keys generated by
+// NewFingerprintKey.
+const fingerprintKeySize = 32
+
+// SecretVersion is a structure that identifies the state of a secret, so that
+// a change made to the secret after it was observed can be detected. It never
+// contains the values of the secret.
+type SecretVersion struct {
+	// Version is the current version of a secret stored in a KV version 2
+	// secrets engine, or 0 if the secret doesn't exist.
+	Version int `json:"version,omitempty"`
+
+	// Fingerprint is an HMAC-SHA-256 of the data of a secret stored in a KV
+	// version 1 secrets engine, which keeps no versions, or empty if the
+	// secret doesn't exist. The HMAC key is never stored with the
+	// fingerprint, so that the data can't be guessed from it.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// NewFingerprintKey generates a random key used to compute the fingerprints of
+// the secrets stored in KV version 1 secrets engines.
+func NewFingerprintKey() ([]byte, error) {
+	key := make([]byte, fingerprintKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate fingerprint key: %w", err)
+	}
+
+	return key, nil
+}
+
+// readSecretVersion retrieves the SecretVersion of the secret stored at the
+// provided path of the KV secrets engine of the provided version mounted at the
+// provided mount point. The provided key is used to compute the fingerprint of
+// a secret stored in a KV version 1 secrets engine.
+func readSecretVersion(vault Vault, version int, mountPoint, path string, key []byte) (SecretVersion, error) {
+	if version == 1 {
+		if len(key) == 0 {
+			return SecretVersion{}, errors.New("no fingerprint key provided")
+		}
+
+		secret, err := vault.Read(kvDataPath(version, mountPoint, path))
+		if err != nil {
+			return SecretVersion{}, err
+		}
+
+		data := kvSecretData(version, secret)
+		if data == nil {
+			return SecretVersion{}, nil
+		}
+
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return SecretVersion{}, err
+		}
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write(dataBytes)
+
+		return SecretVersion{Fingerprint: hex.EncodeToString(mac.Sum(nil))}, nil
+	}
+
+	secret, err := vault.Read(fmt.Sprintf("%s/metadata/%s", mountPoint, path))
+	if err != nil {
+		return SecretVersion{}, err
+	}
+
+	if secret == nil || secret.Data == nil {
+		return SecretVersion{}, nil
+	}
+
+	currentVersion, err := strconv.Atoi(fmt.Sprint(secret.Data["current_version"]))
+	if err != nil {
+		return SecretVersion{}, fmt.Errorf("failed to parse current_version value %v: %w", secret.Data["current_version"], err)
+	}
+
+	return SecretVersion{Version: currentVersion}, nil
+}
+
+// TargetVersion retrieves the SecretVersion of the target secret, using the
+// provided fingerprint key.
+func (p *Copy) TargetVersion(target Vault, key []byte) (SecretVersion, error) {
+	version, err := readSecretVersion(target, p.KVVersion, p.MountPoint, p.Path, key)
+	if err != nil {
+		return SecretVersion{}, fmt.Errorf("failed to retrieve target secret %q version: %w", p.Name(), err)
+	}
+
+	return version, nil
+}
+
+// SourceVersions retrieves the SecretVersion of every source secret of the
+// receiver, mapped by the canonical name of the source secrets, using the
+// provided fingerprint key.
+func (p *Copy) SourceVersions(key []byte) (map[string]SecretVersion, error) {
+	versions := make(map[string]SecretVersion)
+
+	for _, value := range p.SourceSecret.sourceValues() {
+		if _, found := versions[value.Name()]; found {
+			continue
+		}
+
+		version, err := readSecretVersion(value.Source, value.KVVersion, value.MountPoint, value.Path, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve source secret %q version: %w", value.Name(), err)
+		}
+
+		versions[value.Name()] = version
+	}
+
+	return versions, nil
+}